@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -34,10 +37,27 @@ type HTCondorSpec struct {
 	//+optional
 	Submit Node `json:"submit"`
 
+	// HTCondorVersion (series) to run, e.g., 23.0, from the operator image catalog
+	// Defaults to the catalog default version, and a running pool without
+	// a version or base OS keeps the catalog entry it is running
+	// +optional
+	HTCondorVersion string `json:"htcondorVersion,omitempty"`
+
+	// BaseOS of the images, e.g., el8, from the operator image catalog
+	// Defaults to the catalog default base OS
+	// +optional
+	BaseOS string `json:"baseOS,omitempty"`
+
 	// Name for the cluster service
 	//+optional
 	ServiceName string `json:"serviceName"`
 
+	// Cluster domain used to build fully qualified service names
+	// +kubebuilder:default="cluster.local"
+	// +default="cluster.local"
+	//+optional
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+
 	// Configuration values
 	//+optional
 	Config Config `json:"config"`
@@ -53,6 +73,50 @@ type HTCondorSpec struct {
 	// +optional
 	Interactive bool `json:"interactive"`
 
+	// Suspend the pool, deleting its pods until it is resumed
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// QueueName is the Kueue LocalQueue the pool waits in to be admitted as a unit
+	// Kueue then controls when the pool is suspended
+	// +optional
+	QueueName string `json:"queueName,omitempty"`
+
+	// StartupPolicy is ordered to start the manager, then the schedd, and then
+	// execute nodes, or parallel to start them all at once
+	// +kubebuilder:validation:Enum=ordered;parallel
+	// +kubebuilder:default="ordered"
+	// +default="ordered"
+	// +optional
+	StartupPolicy string `json:"startupPolicy,omitempty"`
+
+	// Policy for when execute nodes start, suspend, and preempt jobs
+	// +optional
+	Policy Policy `json:"policy"`
+
+	// Accounting groups share the pool between projects (fair share)
+	// +optional
+	Accounting Accounting `json:"accounting"`
+
+	// Paused drains the pool and suspends it, keeping the queue on the spool
+	// On resume the manager starts first, then the schedd, then execute nodes
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Spool is a persistent volume for each schedd queue, required to pause
+	// The first schedd's claim is <name>-spool, others are <name>-spool-<index>
+	// +optional
+	Spool Storage `json:"spool"`
+
+	// ManagerState is a shared (ReadWriteMany) volume for the state of
+	// highly available managers, which use an emptyDir when unset
+	// +optional
+	ManagerState Storage `json:"managerState"`
+
+	// FailurePolicy for the pool, when a node job fails
+	// +optional
+	FailurePolicy FailurePolicy `json:"failurePolicy"`
+
 	// Time limit for the job
 	// Approximately one year. This cannot be zero or job won't start
 	// +kubebuilder:default=31500000
@@ -60,20 +124,241 @@ type HTCondorSpec struct {
 	// +optional
 	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
 
-	// Resources include limits and requests
+	// Resources are requests for every node, unless the node sets its own
 	// +optional
 	Resources Resource `json:"resources"`
 
+	// RuntimeClassName for all node pods, which also sets the pod overhead
+	// +optional
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+
 	// Security Context
 	// These are applied to all nodes
 	// https://kubernetes.io/docs/tasks/configure-pod-container/security-context/
 	// +optional
 	SecurityContext SecurityContext `json:"securityContext"`
+
+	// Expose the pool outside of the cluster
+	// +optional
+	Expose Expose `json:"expose"`
+
+	// Flocking peers, other pools that jobs can flow to and from
+	// +optional
+	// +listType=atomic
+	Flocking []FlockPeer `json:"flocking,omitempty"`
+
+	// Annex allows execute nodes outside the cluster to join the pool
+	// +optional
+	Annex Annex `json:"annex"`
+
+	// Readiness determines how nodes wait for the central manager
+	// +kubebuilder:default={}
+	// +optional
+	Readiness Readiness `json:"readiness"`
+}
+
+// Policy is a preset for execute nodes, with optional raw expressions
+// that override it. Expressions are HTCondor ClassAd expressions
+// https://htcondor.readthedocs.io/en/latest/admin-manual/ep-policy-configuration.html
+type Policy struct {
+
+	// Preset policy: neverPreempt lets jobs run until they are done,
+	// preemptAfter lets jobs run for preemptAfterHours before they can be
+	// preempted, and desktop suspends jobs when the node is in use
+	// +kubebuilder:validation:Enum=neverPreempt;preemptAfter;desktop
+	// +optional
+	Preset string `json:"preset,omitempty"`
+
+	// PreemptAfterHours a job can run before it can be preempted, for preemptAfter
+	// +optional
+	PreemptAfterHours int32 `json:"preemptAfterHours,omitempty"`
+
+	// Start expression, when a node will start a job
+	// +optional
+	Start string `json:"start,omitempty"`
+
+	// Suspend expression, when a running job is suspended
+	// +optional
+	Suspend string `json:"suspend,omitempty"`
+
+	// Preempt expression, when a running job is evicted
+	// +optional
+	Preempt string `json:"preempt,omitempty"`
+
+	// Kill expression, when a job being evicted is killed
+	// +optional
+	Kill string `json:"kill,omitempty"`
+
+	// MaxJobRetirementTime expression, seconds a job can run before it is preempted
+	// +optional
+	MaxJobRetirementTime string `json:"maxJobRetirementTime,omitempty"`
+}
+
+// Configured is true when there is a preset or any expression
+func (p Policy) Configured() bool {
+	return p.Preset != "" || p.Start != "" || p.Suspend != "" ||
+		p.Preempt != "" || p.Kill != "" || p.MaxJobRetirementTime != ""
+}
+
+// Accounting configures group quotas for the negotiator
+// https://htcondor.readthedocs.io/en/latest/admin-manual/cm-configuration.html#accounting-groups-with-hierarchical-group-quotas
+type Accounting struct {
+
+	// Groups that jobs can set as their accounting_group
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Groups []AccountingGroup `json:"groups,omitempty"`
+}
+
+// AccountingGroup is a group with a static or dynamic quota
+type AccountingGroup struct {
+
+	// Name of the group, e.g., group_physics
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.]+$`
+	Name string `json:"name"`
+
+	// Quota is a static number of slots (cpus) across the execute nodes
+	// Each group needs a quota or a dynamicQuota
+	// +optional
+	Quota int32 `json:"quota,omitempty"`
+
+	// DynamicQuota is a fraction of the pool, e.g., "0.25", instead of a static quota
+	// +optional
+	DynamicQuota string `json:"dynamicQuota,omitempty"`
+
+	// AcceptSurplus allows the group to use slots other groups aren't using
+	// +optional
+	AcceptSurplus bool `json:"acceptSurplus,omitempty"`
+
+	// PriorityFactor for the users in the group, e.g., "10.0"
+	// +optional
+	PriorityFactor string `json:"priorityFactor,omitempty"`
+}
+
+// Storage is a persistent volume claim, e.g., for the schedd spool directory
+// so the job queue survives the submit pod going away
+type Storage struct {
+
+	// Size of the volume, e.g., 1Gi, the volume is not persistent when unset
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName for the volume, defaults to the cluster default
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+}
+
+// FailurePolicy determines what happens when a node job fails
+type FailurePolicy struct {
+
+	// MaxRestarts of the entire pool before it is failed
+	// A restart recreates all of the node jobs
+	// +optional
+	MaxRestarts int32 `json:"maxRestarts,omitempty"`
+}
+
+// Expose the manager (collector) and submit (schedd) outside of the cluster,
+// e.g., for condor_status and condor_submit -remote from a laptop
+type Expose struct {
+
+	// Type of service to create, exposing is disabled when unset
+	// Exposing requires a single submit node (schedd)
+	// +kubebuilder:validation:Enum=NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations for the external services, e.g., for a cloud load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Manager (collector) external address
+	// +optional
+	Manager ExposeNode `json:"manager"`
+
+	// Submit (schedd) external address
+	// +optional
+	Submit ExposeNode `json:"submit"`
+}
+
+// ExposeNode is how one node is reached from outside the cluster
+type ExposeNode struct {
+
+	// Host (IP address or name) clients use to reach the node
+	// This is advertised as the TCP_FORWARDING_HOST, and is required for a
+	// LoadBalancer service, e.g., a reserved address or DNS name for it
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// NodePort for the node, required for a NodePort service
+	// The shared port daemon listens on the same port, since it is advertised
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+}
+
+// FlockPeer is another pool, either managed by the operator (by name)
+// or external (by collector address). Peers managed by the operator
+// must share the same pool password.
+type FlockPeer struct {
+
+	// Name of a HTCondor pool managed by the operator
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the HTCondor pool, defaults to the namespace of this one
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Collector address (host or host:port) of an external pool
+	// +optional
+	Collector string `json:"collector,omitempty"`
+
+	// Schedd hosts of an external pool allowed to flock here
+	// +optional
+	// +listType=atomic
+	Schedds []string `json:"schedds,omitempty"`
+}
+
+// Annex generates a join bundle (as a Secret) for execute nodes outside
+// of the cluster, e.g., bare metal workers, to join the pool
+type Annex struct {
+
+	// Enabled generates the join bundle and tracks external execute nodes
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Collector address (host:port) reachable by the external nodes
+	// Defaults to the exposed manager host and port
+	// +optional
+	Host string `json:"host,omitempty"`
+}
+
+// Readiness gates node startup on the central manager hostname resolving
+// and (for submit and execute nodes) the collector accepting connections
+type Readiness struct {
+
+	// Seconds to wait between attempts
+	// +kubebuilder:default=2
+	// +default=2
+	// +optional
+	Interval int32 `json:"interval,omitempty"`
+
+	// Seconds before a single connection attempt times out
+	// +kubebuilder:default=5
+	// +default=5
+	// +optional
+	Timeout int32 `json:"timeout,omitempty"`
+
+	// Attempts before giving up and failing the pod, 0 to wait forever
+	// +kubebuilder:default=150
+	// +default=150
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
 }
 
 type SecurityContext struct {
 
-	// Privileged container
+	// Privileged container, which is not needed for the container universe
 	// +optional
 	Privileged bool `json:"privileged,omitempty"`
 }
@@ -88,7 +373,7 @@ type Config struct {
 // Node corresponds to a pod (server or worker)
 type Node struct {
 
-	// Image to use for HTCondor
+	// Image to use for HTCondor, overriding the image from the catalog
 	// +optional
 	Image string `json:"image"`
 
@@ -100,6 +385,34 @@ type Node struct {
 	// +optional
 	PullSecret string `json:"pullSecret"`
 
+	// RuntimeClassName for the node pods, overriding the one for all nodes
+	// +optional
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+
+	// BackoffLimit is the number of pod failures before the node job fails
+	// Defaults to 0 for the manager (a failure is fatal) and 100 otherwise
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// RestartPolicy for the node pods
+	// Defaults to Never for the manager, and OnFailure otherwise
+	// +kubebuilder:validation:Enum=OnFailure;Never
+	// +optional
+	RestartPolicy corev1.RestartPolicy `json:"restartPolicy,omitempty"`
+
+	// Replicas of the node, only used by the manager and submit nodes
+	// More than one manager is highly available, with one active negotiator,
+	// and each submit node runs a schedd with its own name and spool
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ContainerUniverse lets jobs run in container images, only used by execute nodes
+	// The operator adds the mounts and the least privileges each runtime needs
+	// +kubebuilder:validation:Enum=apptainer;docker
+	// +optional
+	ContainerUniverse string `json:"containerUniverse,omitempty"`
+
 	// Command will be honored by a server node
 	// +optional
 	Command string `json:"command,omitempty"`
@@ -123,16 +436,103 @@ type Node struct {
 	Ports []int32 `json:"ports"`
 
 	// Key/value pairs for the environment
+	// These are added to the container sorted by key
 	// +optional
 	Environment map[string]string `json:"environment"`
+
+	// Environment variables that can also come from a Secret,
+	// ConfigMap, or the downward API (fieldRef or resourceFieldRef)
+	// These are added after environment, in the order provided
+	// +optional
+	// +listType=atomic
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Populate the environment from entire ConfigMaps or Secrets
+	// +optional
+	// +listType=atomic
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Init containers run (in order) before the HTCondor container starts
+	// +optional
+	// +listType=atomic
+	InitContainers []Container `json:"initContainers,omitempty"`
+
+	// Sidecars run alongside the HTCondor container in the same pod
+	// +optional
+	// +listType=atomic
+	Sidecars []Container `json:"sidecars,omitempty"`
 }
 
-// ContainerResources include limits and requests
+// Container is an extra init or sidecar container for a node
+// The operator volumes are always mounted, as they are for the node
+type Container struct {
+
+	// Name of the container, unique within the pod
+	Name string `json:"name"`
+
+	// Image to use for the container
+	Image string `json:"image"`
+
+	// Command to run, defaults to the image entrypoint
+	// +optional
+	// +listType=atomic
+	Command []string `json:"command,omitempty"`
+
+	// PullAlways will always pull the container
+	// +optional
+	PullAlways bool `json:"pullAlways,omitempty"`
+
+	// Environment variables for the container
+	// +optional
+	// +listType=atomic
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Additional volume mounts, e.g., a different path for an operator volume
+	// +optional
+	// +listType=atomic
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// Resources include limits and requests
+	// +optional
+	Resources Resources `json:"resources"`
+}
+
+// Commands are run at different points in the lifecycle of a node
 type Commands struct {
 
 	// Init runs before anything in both scripts
 	// +optional
 	Init string `json:"init,omitempty"`
+
+	// PreStart runs after config, right before the daemons start
+	// +optional
+	PreStart Hook `json:"preStart,omitempty"`
+
+	// PostReady runs after the daemons have joined the pool
+	// +optional
+	PostReady Hook `json:"postReady,omitempty"`
+
+	// PreStop runs when the pod is asked to terminate, before the daemons stop
+	// +optional
+	PreStop Hook `json:"preStop,omitempty"`
+
+	// OnExit runs after the daemons have exited
+	// +optional
+	OnExit Hook `json:"onExit,omitempty"`
+}
+
+// Hook is a command run in a subshell, with output going to the container log
+type Hook struct {
+
+	// Command (or newline separated commands) to run
+	// +optional
+	Command string `json:"command,omitempty"`
+
+	// OnFailure determines if a failed command is ignored or fails the pod
+	// +kubebuilder:validation:Enum=ignore;fail
+	// +kubebuilder:default="ignore"
+	// +optional
+	OnFailure string `json:"onFailure,omitempty"`
 }
 
 // ContainerResources include limits and requests
@@ -147,26 +547,129 @@ type Resources struct {
 
 type Resource map[string]intstr.IntOrString
 
-// Validate the HTCondor
-func (hq *HTCondor) Validate() bool {
-	if hq.Spec.Manager.Image == "" {
-		hq.Spec.Manager.Image = "htcondor/cm:el7"
-	}
-	// It seems like the docker-compose setup used execute as the final submit image
-	if hq.Spec.Submit.Image == "" {
-		hq.Spec.Submit.Image = "htcondor/submit:el7"
-	}
-	if hq.Spec.Execute.Image == "" {
-		hq.Spec.Execute.Image = "htcondor/execute:el7"
-	}
+// Validate the HTCondor, setting defaults
+// The error names the field to fix
+func (hq *HTCondor) Validate() error {
 	if hq.Spec.ServiceName == "" {
 		hq.Spec.ServiceName = "htc-service"
 	}
+	if hq.Spec.ClusterDomain == "" {
+		hq.Spec.ClusterDomain = "cluster.local"
+	}
 	// This obviously isn't great
 	if hq.Spec.Config.Password == "" {
 		hq.Spec.Config.Password = "password"
 	}
-	return true
+
+	// A node port is advertised, so we need to know it ahead of time
+	if hq.Spec.Expose.Type == corev1.ServiceTypeNodePort {
+		if hq.Spec.Expose.Manager.NodePort == 0 {
+			return fmt.Errorf("expose.manager.nodePort: is required when expose.type is NodePort")
+		}
+		if hq.Spec.Expose.Submit.NodePort == 0 {
+			return fmt.Errorf("expose.submit.nodePort: is required when expose.type is NodePort")
+		}
+	}
+
+	// Without a host the daemons advertise their private (pod) addresses
+	if hq.Spec.Expose.Type == corev1.ServiceTypeLoadBalancer {
+		if hq.Spec.Expose.Manager.Host == "" {
+			return fmt.Errorf("expose.manager.host: is required when expose.type is LoadBalancer")
+		}
+		if hq.Spec.Expose.Submit.Host == "" {
+			return fmt.Errorf("expose.submit.host: is required when expose.type is LoadBalancer")
+		}
+	}
+
+	if hq.Spec.StartupPolicy == "" {
+		hq.Spec.StartupPolicy = "ordered"
+	}
+
+	// Preempting after hours needs to know how many
+	if hq.Spec.Policy.Preset == "preemptAfter" && hq.Spec.Policy.PreemptAfterHours <= 0 {
+		return fmt.Errorf("policy.preemptAfterHours: %d must be greater than 0 for the preemptAfter preset", hq.Spec.Policy.PreemptAfterHours)
+	}
+
+	// Pausing without a persistent spool would lose the queue
+	if hq.Spec.Paused && hq.Spec.Spool.Size == "" {
+		return fmt.Errorf("paused: requires spool.size, so the queue is kept while paused")
+	}
+
+	// One manager is the default, and two or three are highly available,
+	// with HAD electing the one running the negotiator
+	if hq.Spec.Manager.Replicas == 0 {
+		hq.Spec.Manager.Replicas = 1
+	}
+	if hq.Spec.Manager.Replicas > 3 {
+		return fmt.Errorf("manager.replicas: %d is more than the 3 highly available managers supported", hq.Spec.Manager.Replicas)
+	}
+
+	if hq.Spec.Submit.Replicas == 0 {
+		hq.Spec.Submit.Replicas = 1
+	}
+
+	// One external address can't reach more than one schedd
+	if hq.Spec.Expose.Type != "" && hq.Spec.Submit.Replicas > 1 {
+		return fmt.Errorf("expose.type: %q requires submit.replicas to be 1, since each schedd needs its own address", hq.Spec.Expose.Type)
+	}
+
+	// The pool can't work without a manager, but execute nodes can come and go
+	// A highly available manager tolerates one failing
+	if hq.Spec.Manager.Replicas > 1 {
+		hq.Spec.Manager.setFailureDefaults(100, corev1.RestartPolicyOnFailure)
+	}
+	hq.Spec.Manager.setFailureDefaults(0, corev1.RestartPolicyNever)
+	hq.Spec.Submit.setFailureDefaults(100, corev1.RestartPolicyOnFailure)
+	hq.Spec.Execute.setFailureDefaults(100, corev1.RestartPolicyOnFailure)
+
+	// Retries are defaulted by the API server, and 0 means wait forever
+	if hq.Spec.Readiness.Interval <= 0 {
+		hq.Spec.Readiness.Interval = 2
+	}
+	if hq.Spec.Readiness.Timeout <= 0 {
+		hq.Spec.Readiness.Timeout = 5
+	}
+	return nil
+}
+
+// setFailureDefaults sets the backoff limit and restart policy for a node role
+func (n *Node) setFailureDefaults(backoffLimit int32, restartPolicy corev1.RestartPolicy) {
+	if n.BackoffLimit == nil {
+		n.BackoffLimit = &backoffLimit
+	}
+	if n.RestartPolicy == "" {
+		n.RestartPolicy = restartPolicy
+	}
+}
+
+// HighAvailability is true when there is more than one central manager
+func (s HTCondorSpec) HighAvailability() bool {
+	return s.Manager.Replicas > 1
+}
+
+// SharedPort is the port the shared port daemon listens on for a node role
+// This is the default 9618 unless the node is exposed with a NodePort
+func (s HTCondorSpec) SharedPort(role string) int32 {
+	if s.Expose.Type == corev1.ServiceTypeNodePort {
+		if role == "manager" && s.Expose.Manager.NodePort != 0 {
+			return s.Expose.Manager.NodePort
+		}
+		if role == "submit" && s.Expose.Submit.NodePort != 0 {
+			return s.Expose.Submit.NodePort
+		}
+	}
+	return 9618
+}
+
+// AnnexHost is the collector address external execute nodes join
+func (s HTCondorSpec) AnnexHost() string {
+	if s.Annex.Host != "" {
+		return s.Annex.Host
+	}
+	if s.Expose.Manager.Host != "" {
+		return fmt.Sprintf("%s:%d", s.Expose.Manager.Host, s.SharedPort("manager"))
+	}
+	return ""
 }
 
 // WorkerNodes returns the number of worker nodes
@@ -175,8 +678,92 @@ func (hq *HTCondor) WorkerNodes() int32 {
 	return hq.Spec.Size - 1
 }
 
+// Condition types for the HTCondor status
+const (
+	// All pods for the pool are running
+	ConditionReady = "Ready"
+
+	// The spec can be turned into resources, e.g., quantities parse
+	ConditionValid = "Valid"
+
+	// The JobSet is suspended, by the spec or while waiting in a queue
+	ConditionSuspended = "Suspended"
+
+	// The pool is drained and checkpointed, the reason tracks pausing and resuming
+	ConditionPaused = "Paused"
+
+	// Every role has started, the reason tracks which role is being waited on
+	ConditionStarted = "Started"
+)
+
 // HTCondorStatus defines the observed state of HTCondor
-type HTCondorStatus struct{}
+type HTCondorStatus struct {
+
+	// Conditions describe the current state of the pool
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ActiveNegotiator is the manager running the negotiator, when there
+	// is more than one (highly available) manager
+	// +optional
+	ActiveNegotiator string `json:"activeNegotiator,omitempty"`
+
+	// Images resolved from the catalog (or overrides) for each role
+	// +optional
+	Images Images `json:"images,omitempty"`
+
+	// CondorVersion running on the central manager
+	// +optional
+	CondorVersion string `json:"condorVersion,omitempty"`
+
+	// Schedds registered with the collector, and their queues
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Schedds []ScheddStatus `json:"schedds,omitempty"`
+
+	// Execute nodes in the cluster registered with the collector
+	// +optional
+	// +listType=atomic
+	ExecuteNodes []string `json:"executeNodes,omitempty"`
+
+	// Execute nodes outside the cluster (annex) registered with the collector
+	// +optional
+	// +listType=atomic
+	AnnexNodes []string `json:"annexNodes,omitempty"`
+}
+
+// Images for each node role
+type Images struct {
+
+	// +optional
+	Manager string `json:"manager,omitempty"`
+
+	// +optional
+	Submit string `json:"submit,omitempty"`
+
+	// +optional
+	Execute string `json:"execute,omitempty"`
+}
+
+// ScheddStatus is the queue for one schedd
+type ScheddStatus struct {
+
+	// Name of the schedd, e.g., as used with condor_q -name
+	Name string `json:"name"`
+
+	// Jobs in the queue by status
+	// +optional
+	Idle int32 `json:"idle,omitempty"`
+
+	// +optional
+	Running int32 `json:"running,omitempty"`
+
+	// +optional
+	Held int32 `json:"held,omitempty"`
+}
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// validateAccounting checks the group quotas, which together can't ask
+// for more than the pool has: static quotas are at most the slots in the
+// pool, and dynamic quotas are fractions that add up to at most one
+func validateAccounting(cluster *api.HTCondor) error {
+
+	static := int64(0)
+	dynamic := float64(0)
+	for i, group := range cluster.Spec.Accounting.Groups {
+		field := fmt.Sprintf("spec.accounting.groups[%d]", i)
+		if group.Quota < 0 {
+			return fmt.Errorf("%s.quota: %d must not be negative", field, group.Quota)
+		}
+		if group.Quota == 0 && group.DynamicQuota == "" {
+			return fmt.Errorf("%s: %s needs a quota or a dynamicQuota", field, group.Name)
+		}
+		if group.DynamicQuota != "" {
+			if group.Quota != 0 {
+				return fmt.Errorf("%s: %s has both a quota and a dynamicQuota", field, group.Name)
+			}
+			fraction, err := strconv.ParseFloat(group.DynamicQuota, 64)
+			if err != nil || fraction < 0 || fraction > 1 {
+				return fmt.Errorf("%s.dynamicQuota: %q is not a fraction between 0 and 1", field, group.DynamicQuota)
+			}
+			dynamic += fraction
+		}
+		if group.PriorityFactor != "" {
+			factor, err := strconv.ParseFloat(group.PriorityFactor, 64)
+			if err != nil || factor <= 0 {
+				return fmt.Errorf("%s.priorityFactor: %q is not a positive number", field, group.PriorityFactor)
+			}
+		}
+		static += int64(group.Quota)
+	}
+	slots := getPoolSlots(cluster)
+	if static > slots {
+		return fmt.Errorf("spec.accounting.groups: static quotas add up to %d, more than the %d slots (cpus) in the pool", static, slots)
+	}
+	if dynamic > 1 {
+		return fmt.Errorf("spec.accounting.groups: dynamic quotas add up to %g, more than the whole pool", dynamic)
+	}
+	return nil
+}
+
+// getPoolSlots is the number of cpus the execute nodes advertise, which is
+// what static quotas count. Each node has NUM_CPUS from its cpu limit (see
+// the cgroups template), or the size of the pool without one
+func getPoolSlots(cluster *api.HTCondor) int64 {
+	cpus := int64(cluster.Spec.Size)
+	limit, ok := cluster.Spec.Execute.Resources.Limits["cpu"]
+	if ok {
+		quantity, err := resource.ParseQuantity(limit.String())
+		if err == nil && quantity.MilliValue() > 0 {
+
+			// Partial cpus are rounded up, like in the start script
+			cpus = (quantity.MilliValue() + 999) / 1000
+		}
+	}
+	return int64(cluster.Spec.Size) * cpus
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+func TestValidateAccounting(t *testing.T) {
+	fourCPUs := api.Resource{"cpu": intstr.FromInt(4)}
+	tests := []struct {
+		name    string
+		size    int32
+		limits  api.Resource
+		groups  []api.AccountingGroup
+		wantErr bool
+	}{
+		{
+			name:   "static quota counts cpus on every node",
+			size:   2,
+			limits: fourCPUs,
+			groups: []api.AccountingGroup{{Name: "group_a", Quota: 8}},
+		},
+		{
+			name:    "static quotas over the pool cpus",
+			size:    2,
+			limits:  fourCPUs,
+			groups:  []api.AccountingGroup{{Name: "group_a", Quota: 6}, {Name: "group_b", Quota: 3}},
+			wantErr: true,
+		},
+		{
+			name:   "partial cpus are rounded up",
+			size:   2,
+			limits: api.Resource{"cpu": intstr.FromString("1500m")},
+			groups: []api.AccountingGroup{{Name: "group_a", Quota: 4}},
+		},
+		{
+			name:   "without a cpu limit each node has the pool size",
+			size:   3,
+			groups: []api.AccountingGroup{{Name: "group_a", Quota: 9}},
+		},
+		{
+			name:   "dynamic quotas add up to one",
+			size:   1,
+			groups: []api.AccountingGroup{{Name: "group_a", DynamicQuota: "0.75"}, {Name: "group_b", DynamicQuota: "0.25"}},
+		},
+		{
+			name:    "dynamic quotas over one",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", DynamicQuota: "0.75"}, {Name: "group_b", DynamicQuota: "0.5"}},
+			wantErr: true,
+		},
+		{
+			name:    "dynamic quota that is not a fraction",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", DynamicQuota: "half"}},
+			wantErr: true,
+		},
+		{
+			name:    "both a quota and a dynamic quota",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", Quota: 1, DynamicQuota: "0.5"}},
+			wantErr: true,
+		},
+		{
+			name:    "no quota",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", AcceptSurplus: true}},
+			wantErr: true,
+		},
+		{
+			name:    "negative quota",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", Quota: -1}},
+			wantErr: true,
+		},
+		{
+			name:    "priority factor that is not positive",
+			size:    1,
+			groups:  []api.AccountingGroup{{Name: "group_a", Quota: 1, PriorityFactor: "0"}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := &api.HTCondor{}
+			cluster.Spec.Size = test.size
+			cluster.Spec.Execute.Resources.Limits = test.limits
+			cluster.Spec.Accounting.Groups = test.groups
+			err := validateAccounting(cluster)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+const (
+	annexSuffix = "-annex"
+
+	// The annex config advertises this attribute so we can tell the nodes apart
+	annexAttribute = "HTCondorOperatorAnnex"
+)
+
+// validateAnnex checks external execute nodes have a collector to join
+func validateAnnex(cluster *api.HTCondor) error {
+	if cluster.Spec.Annex.Enabled && cluster.Spec.AnnexHost() == "" {
+		return fmt.Errorf("annex.enabled: requires spec.annex.host or spec.expose.manager.host")
+	}
+	return nil
+}
+
+// ensureAnnex creates the join bundle for external execute nodes and
+// updates status with the execute nodes registered with the collector
+func (r *HTCondorReconciler) ensureAnnex(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
+
+	// We need the central manager to create a token and query the collector
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		r.Log.Info("🏝️ Waiting for the manager to create the annex bundle", "Reason", err.Error())
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	err = r.ensureAnnexSecret(ctx, cluster, manager)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateExecuteNodes(ctx, cluster, manager)
+}
+
+// ensureAnnexSecret applies the join bundle secret
+// The token is only created once, and kept across applies
+func (r *HTCondorReconciler) ensureAnnexSecret(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	manager *corev1.Pod,
+) error {
+
+	// The host is checked by validateAnnex
+	host := cluster.Spec.AnnexHost()
+	existing := &corev1.Secret{}
+	err := r.Get(
+		ctx,
+		types.NamespacedName{Name: cluster.Name + annexSuffix, Namespace: cluster.Namespace},
+		existing,
+	)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	token := string(existing.Data["token"])
+
+	// The token is scoped to joining the pool as an execute node
+	if token == "" {
+		token, err = r.execPod(ctx, manager, "manager-node", []string{
+			"condor_token_create",
+			"-identity", "condor_pool",
+			"-authz", "READ",
+			"-authz", "ADVERTISE_MASTER",
+			"-authz", "ADVERTISE_STARTD",
+		})
+		if err != nil {
+			r.Log.Error(err, "❌ Failed to create HTCondor annex token")
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "AnnexFailed", "Failed to create annex token: %s", err)
+			return err
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.Name + annexSuffix,
+			Namespace: cluster.Namespace,
+		},
+		Data: map[string][]byte{
+			"condor_host": []byte(host),
+			"annex.conf":  []byte(getAnnexConfig(cluster, host)),
+			"token":       []byte(strings.TrimSpace(token)),
+		},
+	}
+	return r.apply(ctx, cluster, secret)
+}
+
+// getAnnexConfig is the config an external execute node drops into config.d
+// The token goes in tokens.d (e.g., /etc/condor/tokens.d/annex)
+func getAnnexConfig(cluster *api.HTCondor, host string) string {
+	return fmt.Sprintf(`# Join the %s/%s HTCondor pool as an execute node
+CONDOR_HOST = %s
+DAEMON_LIST = MASTER, STARTD
+USE_SHARED_PORT = True
+
+# Authenticate with the token, and reach the node through the collector
+SEC_DEFAULT_AUTHENTICATION_METHODS = IDTOKENS
+CCB_ADDRESS = $(COLLECTOR_HOST)
+
+# Mark the node so the operator can report it
+%s = True
+STARTD_ATTRS = $(STARTD_ATTRS) %s
+`, cluster.Namespace, cluster.Name, host, annexAttribute, annexAttribute)
+}
+
+// updateExecuteNodes queries the collector for execute nodes, and reports
+// the ones in the cluster separately from the ones in the annex
+func (r *HTCondorReconciler) updateExecuteNodes(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	manager *corev1.Pod,
+) error {
+
+	out, err := r.execPod(ctx, manager, "manager-node", []string{
+		"condor_status", "-startd", "-af", "Machine", annexAttribute,
+	})
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to query HTCondor collector for execute nodes")
+		return err
+	}
+
+	executeNodes := []string{}
+	annexNodes := []string{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || seen[fields[0]] {
+			continue
+		}
+
+		// Partitionable slots mean the same machine can show up more than once
+		seen[fields[0]] = true
+		if fields[1] == "true" {
+			annexNodes = append(annexNodes, fields[0])
+		} else {
+			executeNodes = append(executeNodes, fields[0])
+		}
+	}
+	sort.Strings(executeNodes)
+	sort.Strings(annexNodes)
+
+	if strings.Join(executeNodes, ",") == strings.Join(cluster.Status.ExecuteNodes, ",") &&
+		strings.Join(annexNodes, ",") == strings.Join(cluster.Status.AnnexNodes, ",") {
+		return nil
+	}
+	r.Log.Info("🏝️ HTCondor execute nodes changed", "Execute", executeNodes, "Annex", annexNodes)
+	r.Recorder.Eventf(
+		cluster, corev1.EventTypeNormal, "ExecuteNodesChanged",
+		"%d execute nodes in the cluster and %d in the annex are registered", len(executeNodes), len(annexNodes),
+	)
+	cluster.Status.ExecuteNodes = executeNodes
+	cluster.Status.AnnexNodes = annexNodes
+	return r.Status().Update(ctx, cluster)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// fieldManager owns the fields the operator applies
+const fieldManager = "htcondor-operator"
+
+// apply server-side applies the desired state of an owned object
+// The object is updated in place, and an event is recorded when it changes
+func (r *HTCondorReconciler) apply(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	obj client.Object,
+) error {
+
+	// Apply requires the kind, which typed objects don't carry
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	err = ctrl.SetControllerReference(cluster, obj, r.Scheme)
+	if err != nil {
+		return err
+	}
+
+	// Look up the current version to tell creates and updates apart
+	existing := obj.DeepCopyObject().(client.Object)
+	err = r.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	err = r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to apply", "Kind", gvk.Kind, "Name", obj.GetName())
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, gvk.Kind+"Failed", "Failed to apply %s %s: %s", gvk.Kind, obj.GetName(), err)
+		return err
+	}
+
+	if !found {
+		r.Log.Info("✨ Created", "Kind", gvk.Kind, "Name", obj.GetName())
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, gvk.Kind+"Created", "Created %s %s", gvk.Kind, obj.GetName())
+	} else if existing.GetResourceVersion() != obj.GetResourceVersion() {
+		r.Log.Info("🔁 Updated", "Kind", gvk.Kind, "Name", obj.GetName())
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, gvk.Kind+"Updated", "Updated %s %s", gvk.Kind, obj.GetName())
+	}
+	return nil
+}
+
+// prune deletes objects the HTCondor owns that it no longer wants, e.g.,
+// the service for a schedd after spec.submit.replicas shrinks
+func (r *HTCondorReconciler) prune(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	list client.ObjectList,
+	wanted map[string]bool,
+) error {
+
+	err := r.List(ctx, list, client.InNamespace(cluster.Namespace))
+	if err != nil {
+		return err
+	}
+	return meta.EachListItem(list, func(item runtime.Object) error {
+		obj := item.(client.Object)
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil || owner.UID != cluster.UID || wanted[obj.GetName()] {
+			return nil
+		}
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return err
+		}
+		err = r.Delete(ctx, obj)
+		if err != nil && !errors.IsNotFound(err) {
+			r.Log.Error(err, "❌ Failed to delete", "Kind", gvk.Kind, "Name", obj.GetName())
+			return err
+		}
+		r.Log.Info("🧹 Deleted", "Kind", gvk.Kind, "Name", obj.GetName())
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, gvk.Kind+"Deleted", "Deleted %s %s", gvk.Kind, obj.GetName())
+		return nil
+	})
+}
@@ -12,8 +12,10 @@ package controllers
 
 import (
 	"fmt"
+	"sort"
 
 	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/v1alpha1"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 )
@@ -48,8 +50,9 @@ func (r *HTCondorReconciler) getContainers(
 	containers := []corev1.Container{}
 	containerName := fmt.Sprintf("%s-node", defaultName)
 
-	// Prepare resources
-	resources, err := r.getContainerResources(&node)
+	// Prepare resources, for the node role
+	resources, err := r.getNodeResources(cluster, node, defaultName)
+	r.Log.Info("👑️ HTCondor", "Container.Resources", resources)
 	if err != nil {
 		r.Log.Error(err, "ERROR getting container resources")
 		return containers, err
@@ -66,14 +69,11 @@ func (r *HTCondorReconciler) getContainers(
 		TTY:             true,
 		Resources:       resources,
 		Command:         command,
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: &cluster.Spec.SecurityContext.Privileged,
-		},
+		SecurityContext: getSecurityContext(cluster, node, defaultName),
 	}
 
 	// Ports and environment
 	ports := []corev1.ContainerPort{}
-	envars := []corev1.EnvVar{}
 
 	// For now we will take ports and have container port == exposed port
 	for _, port := range node.Ports {
@@ -83,17 +83,115 @@ func (r *HTCondorReconciler) getContainers(
 		}
 		ports = append(ports, newPort)
 	}
-	// Add environment variables
-	for key, value := range node.Environment {
+	newContainer.Ports = ports
+
+	// Environment, including references to secrets, config maps, etc.
+	newContainer.Env = getEnvironment(node)
+
+	// Each schedd is named for its job in the JobSet
+	if defaultName == "submit" {
+		scheddIndex := corev1.EnvVar{
+			Name: "HTCONDOR_SCHEDD_INDEX",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: fmt.Sprintf("metadata.labels['%s']", jobset.JobIndexKey),
+				},
+			},
+		}
+		newContainer.Env = append([]corev1.EnvVar{scheddIndex}, newContainer.Env...)
+	}
+	newContainer.EnvFrom = node.EnvFrom
+	containers = append(containers, newContainer)
+	return containers, nil
+}
+
+// getExtraContainers gets init or sidecar containers for a HTCondor node
+func (r *HTCondorReconciler) getExtraContainers(
+	extras []api.Container,
+	mounts []corev1.VolumeMount,
+	field string,
+) ([]corev1.Container, error) {
+
+	containers := []corev1.Container{}
+	for _, extra := range extras {
+
+		pullPolicy := corev1.PullIfNotPresent
+		if extra.PullAlways {
+			pullPolicy = corev1.PullAlways
+		}
+
+		resources, err := r.getContainerResources(&extra.Resources, fmt.Sprintf("%s[%s].resources", field, extra.Name))
+		if err != nil {
+			r.Log.Error(err, "ERROR getting container resources", "Container", extra.Name)
+			return containers, err
+		}
+
+		// Extra containers get the operator volumes, plus any they ask for
+		volumeMounts := []corev1.VolumeMount{}
+		volumeMounts = append(volumeMounts, mounts...)
+		volumeMounts = append(volumeMounts, extra.VolumeMounts...)
+
+		newContainer := corev1.Container{
+			Name:            extra.Name,
+			Image:           extra.Image,
+			ImagePullPolicy: pullPolicy,
+			Command:         extra.Command,
+			Env:             extra.Env,
+			VolumeMounts:    volumeMounts,
+			Resources:       resources,
+		}
+		containers = append(containers, newContainer)
+	}
+	return containers, nil
+}
+
+// getEnvironment assembles the environment for a node container
+// Literal key/value pairs are sorted so the pod template is stable, and
+// the full EnvVar list (that might reference them) comes after
+func getEnvironment(node api.Node) []corev1.EnvVar {
+	keys := []string{}
+	for key := range node.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	envars := []corev1.EnvVar{}
+	for _, key := range keys {
 		newEnvar := corev1.EnvVar{
 			Name:  key,
-			Value: value,
+			Value: node.Environment[key],
 		}
 		envars = append(envars, newEnvar)
 	}
+	return append(envars, node.Env...)
+}
 
-	newContainer.Ports = ports
-	newContainer.Env = envars
-	containers = append(containers, newContainer)
-	return containers, nil
+// validateContainerNames checks init and sidecar containers have a unique name
+// in the pod, and don't take the name of a container the operator adds
+func validateContainerNames(cluster *api.HTCondor) error {
+	nodes := map[string]api.Node{
+		"manager": cluster.Spec.Manager,
+		"submit":  cluster.Spec.Submit,
+		"execute": cluster.Spec.Execute,
+	}
+	for _, role := range []string{"manager", "submit", "execute"} {
+		node := nodes[role]
+		names := map[string]string{fmt.Sprintf("%s-node", role): "the HTCondor node"}
+		if role == "execute" && node.ContainerUniverse == "docker" {
+			names[dockerContainerName] = "the docker daemon"
+			names[dockerClientContainerName] = "the docker client"
+		}
+		extras := append(append([]api.Container{}, node.InitContainers...), node.Sidecars...)
+		for i, extra := range extras {
+			field := fmt.Sprintf("spec.%s.initContainers", role)
+			if i >= len(node.InitContainers) {
+				field = fmt.Sprintf("spec.%s.sidecars", role)
+			}
+			if owner, ok := names[extra.Name]; ok {
+				return fmt.Errorf("%s: %q is already used by %s", field, extra.Name, owner)
+			}
+			names[extra.Name] = field
+		}
+	}
+	return nil
 }
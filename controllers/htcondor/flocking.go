@@ -0,0 +1,173 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+const (
+	flockingSuffix = "-flocking"
+	flockingConfig = "flocking.conf"
+)
+
+// ensureFlocking renders the flocking config map, updating it as peers change
+// This is mounted into every node, and the daemons reconfigure on change
+func (r *HTCondorReconciler) ensureFlocking(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
+
+	config, err := r.getFlockingConfig(ctx, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	data := map[string]string{flockingConfig: config}
+	cm := r.newConfigMap(cluster, cluster.Name+flockingSuffix, data)
+	return ctrl.Result{}, r.apply(ctx, cluster, cm)
+}
+
+// getFlockingConfig resolves flocking peers into FLOCK_TO and FLOCK_FROM
+// Peers managed by the operator that do not exist (yet) are skipped
+func (r *HTCondorReconciler) getFlockingConfig(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (string, error) {
+
+	flockTo := []string{}
+	flockFrom := []string{}
+
+	for _, peer := range cluster.Spec.Flocking {
+
+		// An external pool
+		if peer.Name == "" {
+			if peer.Collector != "" {
+				flockTo = append(flockTo, peer.Collector)
+			}
+			flockFrom = append(flockFrom, peer.Schedds...)
+			continue
+		}
+
+		namespace := peer.Namespace
+		if namespace == "" {
+			namespace = cluster.Namespace
+		}
+		other := &api.HTCondor{}
+		err := r.Get(ctx, types.NamespacedName{Name: peer.Name, Namespace: namespace}, other)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				r.Log.Info("🐦 Flocking peer not found, skipping", "Name", peer.Name, "Namespace", namespace)
+				r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "FlockingPeerSkipped", "Flocking peer %s/%s was not found", namespace, peer.Name)
+				continue
+			}
+			return "", err
+		}
+
+		// Pools authenticate to each other with the pool password
+		other.Validate()
+		if other.Spec.Config.Password != cluster.Spec.Config.Password {
+			r.Log.Info("🐦 Flocking peer has a different pool password, skipping", "Name", peer.Name, "Namespace", namespace)
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "FlockingPeerSkipped", "Flocking peer %s/%s has a different pool password", namespace, peer.Name)
+			continue
+		}
+		flockTo = append(flockTo, getCollectorAddress(other))
+		flockFrom = append(flockFrom, getScheddHosts(other)...)
+	}
+
+	config := "# Rendered by the htcondor-operator from spec.flocking\n"
+	if len(flockTo) > 0 {
+		config += fmt.Sprintf("FLOCK_TO = %s\n", strings.Join(flockTo, ", "))
+
+		// The negotiators of the pools we flock to claim slots for our schedds
+		negotiators := strings.Join(getFlockingHosts(flockTo), ", ")
+		config += fmt.Sprintf("ALLOW_NEGOTIATOR = $(ALLOW_NEGOTIATOR), %s\n", negotiators)
+		config += fmt.Sprintf("ALLOW_NEGOTIATOR_SCHEDD = $(ALLOW_NEGOTIATOR_SCHEDD), %s\n", negotiators)
+	}
+	if len(flockFrom) > 0 {
+		config += fmt.Sprintf("FLOCK_FROM = %s\n", strings.Join(flockFrom, ", "))
+
+		// Schedds flocking to us query the collector and run jobs on our startds
+		schedds := strings.Join(getFlockingHosts(flockFrom), ", ")
+		config += fmt.Sprintf("ALLOW_READ = $(ALLOW_READ), %s\n", schedds)
+		config += fmt.Sprintf("ALLOW_WRITE = $(ALLOW_WRITE), %s\n", schedds)
+	}
+	return config, nil
+}
+
+// getFlockingHosts are the hosts, without a port, for ALLOW_* lists
+func getFlockingHosts(addresses []string) []string {
+	hosts := []string{}
+	for _, address := range addresses {
+		host, _, _ := strings.Cut(address, ":")
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// getCollectorAddress is the manager service address of a pool in the cluster
+func getCollectorAddress(cluster *api.HTCondor) string {
+	return fmt.Sprintf(
+		"%s%s.%s.svc.%s:%d",
+		cluster.Name, managerServiceSuffix, cluster.Namespace, cluster.Spec.ClusterDomain, collectorPort,
+	)
+}
+
+// getScheddHosts are the hostnames of the submit nodes of a pool in the cluster
+// Each schedd is the first pod of its own replicated job in the JobSet
+func getScheddHosts(cluster *api.HTCondor) []string {
+	hosts := []string{}
+	for i := int32(0); i < cluster.Spec.Submit.Replicas; i++ {
+		hosts = append(hosts, fmt.Sprintf(
+			"%s-%s-0-0.%s.%s.svc.%s",
+			cluster.Name, getScheddJobName(i), cluster.Spec.ServiceName, cluster.Namespace, cluster.Spec.ClusterDomain,
+		))
+	}
+	return hosts
+}
+
+// findFlockingPools finds pools with a flocking peer that has changed
+// so they can be reconciled (and re-rendered) when peers come and go
+func (r *HTCondorReconciler) findFlockingPools(obj client.Object) []reconcile.Request {
+	requests := []reconcile.Request{}
+
+	pools := &api.HTCondorList{}
+	err := r.List(context.Background(), pools)
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to list HTCondor pools for flocking")
+		return requests
+	}
+	for _, pool := range pools.Items {
+		for _, peer := range pool.Spec.Flocking {
+			namespace := peer.Namespace
+			if namespace == "" {
+				namespace = pool.Namespace
+			}
+			if peer.Name == obj.GetName() && namespace == obj.GetNamespace() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// updateActiveNegotiator shows which highly available manager HAD elected
+// to run the negotiator, with an event when it fails over
+func (r *HTCondorReconciler) updateActiveNegotiator(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) error {
+
+	// Any running manager can answer, since each runs a collector
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return err
+	}
+	out, err := r.execPod(ctx, manager, "manager-node", []string{"condor_status", "-negotiator", "-af", "Machine"})
+	if err != nil {
+		return err
+	}
+
+	// There can briefly be none (or two) while HAD holds an election
+	negotiator := ""
+	lines := strings.Fields(out)
+	if len(lines) > 0 {
+		negotiator = lines[0]
+	}
+	if negotiator == cluster.Status.ActiveNegotiator {
+		return nil
+	}
+	if negotiator != "" && cluster.Status.ActiveNegotiator != "" {
+		r.Recorder.Eventf(
+			cluster, corev1.EventTypeWarning, "NegotiatorFailover",
+			"The negotiator moved from %s to %s", cluster.Status.ActiveNegotiator, negotiator,
+		)
+	}
+	r.Log.Info("🗳️ Active negotiator", "Name", cluster.Name, "Manager", negotiator)
+	cluster.Status.ActiveNegotiator = negotiator
+	return r.Status().Update(ctx, cluster)
+}
@@ -15,20 +15,21 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	jobset "sigs.k8s.io/jobset/api/v1alpha1"
 
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 )
 
 // A HTCondor is one or more workers plus a main server
 
-// newHTCondor creates a new HTCondor
+// ensureHTCondor applies the desired state of everything the HTCondor owns
 func (r *HTCondorReconciler) ensureHTCondor(
 	ctx context.Context,
 	cluster *api.HTCondor,
@@ -40,6 +41,12 @@ func (r *HTCondorReconciler) ensureHTCondor(
 		return result, err
 	}
 
+	// Flocking peers are rendered separately, since they change
+	result, err = r.ensureFlocking(ctx, cluster)
+	if err != nil {
+		return result, err
+	}
+
 	// Create headless service for the HTCondor cluster
 	selector := map[string]string{"cluster-name": cluster.Name}
 	result, err = r.exposeServices(ctx, cluster, selector)
@@ -47,174 +54,242 @@ func (r *HTCondorReconciler) ensureHTCondor(
 		return result, err
 	}
 
+	// And a stable ClusterIP service that is the CONDOR_HOST
+	result, err = r.exposeManagerService(ctx, cluster)
+	if err != nil {
+		return result, err
+	}
+
+	// And a service for each schedd
+	result, err = r.exposeScheddServices(ctx, cluster)
+	if err != nil {
+		return result, err
+	}
+
+	// Optionally expose the manager and submit outside of the cluster
+	if cluster.Spec.Expose.Type != "" {
+		result, err = r.exposeExternalServices(ctx, cluster)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// The schedd queue is kept on a persistent spool, e.g., to pause
+	if cluster.Spec.Spool.Size != "" {
+		// Each schedd has its own spool, kept when replicas are scaled down
+		for i := int32(0); i < cluster.Spec.Submit.Replicas; i++ {
+			err = r.ensureVolumeClaim(
+				ctx, cluster, getSpoolName(cluster, i), cluster.Spec.Spool,
+				corev1.ReadWriteOnce, "spec.spool",
+			)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Highly available managers can share their state on one volume
+	if cluster.Spec.HighAvailability() && cluster.Spec.ManagerState.Size != "" {
+		err = r.ensureVolumeClaim(
+			ctx, cluster, cluster.Name+managerStateSuffix, cluster.Spec.ManagerState,
+			corev1.ReadWriteMany, "spec.managerState",
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Services and secrets that are no longer wanted are deleted, e.g., when
+	// spec.expose is removed. Volume claims are kept, since they hold the queue
+	err = r.prune(ctx, cluster, &corev1.ServiceList{}, getServiceNames(cluster))
+	if err != nil {
+		return result, err
+	}
+	err = r.prune(ctx, cluster, &corev1.SecretList{}, getSecretNames(cluster))
+	if err != nil {
+		return result, err
+	}
+
 	// Create the batch job that brings it all together!
 	// A batchv1.Job can hold a spec for containers that use the configs we just made
-	_, result, err = r.getCluster(ctx, cluster)
+	job, result, err := r.getCluster(ctx, cluster)
+	if err != nil || result.Requeue {
+		return result, err
+	}
+	err = r.updateSuspended(ctx, cluster, job)
 	if err != nil {
 		return result, err
 	}
-	// And we re-queue so the Ready condition triggers next steps!
-	return ctrl.Result{Requeue: true}, nil
-}
 
-// getExistingJob gets an existing job that matches our CRD
-func (r *HTCondorReconciler) getExistingJob(
-	ctx context.Context,
-	cluster *api.HTCondor,
-) (*jobset.JobSet, error) {
+	// Drain and checkpoint a paused pool, or track it resuming
+	result, err = r.ensurePaused(ctx, cluster)
+	if err != nil || result.Requeue || result.RequeueAfter > 0 {
+		return result, err
+	}
 
-	existing := &jobset.JobSet{}
-	err := r.Client.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      cluster.Name,
-			Namespace: cluster.Namespace,
-		},
-		existing,
-	)
-	return existing, err
+	// External execute nodes need a join bundle, and are tracked in status
+	suspended := meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended)
+	if cluster.Spec.Annex.Enabled && !suspended {
+		result, err = r.ensureAnnex(ctx, cluster)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
 }
 
-// getCluster does an actual check if we have a jobset in the namespace
+// getCluster applies the jobset, recreating it if an immutable field changed
 func (r *HTCondorReconciler) getCluster(
 	ctx context.Context,
 	cluster *api.HTCondor,
 ) (*jobset.JobSet, ctrl.Result, error) {
 
-	// Look for an existing job
-	existing, err := r.getExistingJob(ctx, cluster)
-
-	// Create a new job if it does not exist
+	job, err := r.newJobSet(cluster)
 	if err != nil {
+		r.Log.Error(
+			err,
+			"Failed to create new HTCondor JobSet",
+			"Namespace:", job.Namespace,
+			"Name:", job.Name,
+		)
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "JobSetInvalid", "Failed to generate JobSet: %s", err)
+		return job, ctrl.Result{}, err
+	}
 
-		if errors.IsNotFound(err) {
-			job, err := r.newJobSet(cluster)
-			if err != nil {
-				r.Log.Error(
-					err,
-					"Failed to create new HTCondor JobSet",
-					"Namespace:", job.Namespace,
-					"Name:", job.Name,
-				)
-				// If there is an error, return the existing (empty)
-				return existing, ctrl.Result{}, err
-			}
-
-			r.Log.Info(
-				"✨ Creating a new HTCondor JobSet ✨",
-				"Namespace:", job.Namespace,
-				"Name:", job.Name,
-			)
+	err = r.apply(ctx, cluster, job)
 
-			err = r.Client.Create(ctx, job)
-			if err != nil {
-				r.Log.Error(
-					err,
-					"Failed to create new HTCondor JobSet",
-					"Namespace:", job.Namespace,
-					"Name:", job.Name,
-				)
-				return existing, ctrl.Result{}, err
-			}
+	// Most of the JobSet (the replicated jobs) cannot be changed once created,
+	// so delete it and create it again on the next reconcile. Any other
+	// invalid JobSet is a problem with the spec, and is left running
+	if isImmutableChange(err) {
+		r.Log.Info(
+			"🔁 Recreating HTCondor JobSet to change immutable fields",
+			"Namespace:", job.Namespace,
+			"Name:", job.Name,
+		)
+		r.Recorder.Eventf(
+			cluster, corev1.EventTypeNormal, "JobSetRecreated",
+			"Deleting JobSet %s to recreate it with immutable changes", job.Name,
+		)
+		err = r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationForeground))
+		if err != nil && !errors.IsNotFound(err) {
 			return job, ctrl.Result{}, err
+		}
+		return job, ctrl.Result{Requeue: true}, nil
+	}
+	if err == nil && cluster.Spec.QueueName != "" && wantSuspended(cluster) {
+		err = r.applySuspend(ctx, job)
+	}
+	return job, ctrl.Result{}, err
+}
+
+// immutableJobSetFields cannot be changed once the JobSet is created
+var immutableJobSetFields = map[string]bool{
+	"spec.replicatedJobs": true,
+	"spec.failurePolicy":  true,
+}
 
-		} else if err != nil {
-			r.Log.Error(err, "Failed to get HTCondor JobSet")
-			return existing, ctrl.Result{}, err
+// isImmutableChange is true when the JobSet was rejected for changing an
+// immutable field, and not because it is otherwise invalid
+func isImmutableChange(err error) bool {
+	if !errors.IsInvalid(err) {
+		return false
+	}
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if immutableJobSetFields[cause.Field] {
+			return true
 		}
+	}
+	return false
+}
 
-	} else {
-		r.Log.Info(
-			"🎉 Found existing HTCondor JobSet 🎉",
-			"Namespace:", existing.Namespace,
-			"Name:", existing.Name,
-		)
+// getSecretNames are the secrets the HTCondor wants, anything else it owns is pruned
+func getSecretNames(cluster *api.HTCondor) map[string]bool {
+	names := map[string]bool{}
+	if cluster.Spec.Annex.Enabled {
+		names[cluster.Name+annexSuffix] = true
 	}
-	return existing, ctrl.Result{}, err
+	return names
 }
 
-// getConfigMap generates the config map, when does not exist
+// getServiceNames are the services the HTCondor wants, anything else it owns is pruned
+func getServiceNames(cluster *api.HTCondor) map[string]bool {
+	names := map[string]bool{
+		cluster.Spec.ServiceName:            true,
+		cluster.Name + managerServiceSuffix: true,
+	}
+	for i := int32(0); i < cluster.Spec.Submit.Replicas; i++ {
+		names[fmt.Sprintf("%s%s-%d", cluster.Name, scheddServiceSuffix, i)] = true
+	}
+	if cluster.Spec.Expose.Type != "" {
+		for _, role := range []string{"manager", "submit"} {
+			names[cluster.Name+"-"+role+externalServiceSuffix] = true
+		}
+	}
+	return names
+}
+
+// getConfigMap generates the data for a config map
 func (r *HTCondorReconciler) getConfigMap(
-	ctx context.Context,
 	cluster *api.HTCondor,
 	configName string,
 	configFullName string,
-) (*corev1.ConfigMap, ctrl.Result, error) {
+) (*corev1.ConfigMap, error) {
 
 	// Data for the config map
 	data := map[string]string{}
-	cm := &corev1.ConfigMap{}
 
 	// This is currently the only config we support
 	if configName == "entrypoint" {
 
 		// Generate data for both the start-manager.sh, start-execute.sh, and start-submit.sh
-		managerStart, err := generateScript(cluster, cluster.Spec.Manager, startManagerTemplate)
+		managerStart, err := generateScript(cluster, cluster.Spec.Manager, "manager", startManagerTemplate)
 		if err != nil {
-			return cm, ctrl.Result{}, err
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "ConfigMapFailed", "Failed to generate manager script: %s", err)
+			return nil, err
 		}
-		executeStart, err := generateScript(cluster, cluster.Spec.Execute, startExecuteTemplate)
+		executeStart, err := generateScript(cluster, cluster.Spec.Execute, "execute", startExecuteTemplate)
 		if err != nil {
-			return cm, ctrl.Result{}, err
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "ConfigMapFailed", "Failed to generate execute script: %s", err)
+			return nil, err
 		}
-		submitStart, err := generateScript(cluster, cluster.Spec.Submit, startSubmitTemplate)
+		submitStart, err := generateScript(cluster, cluster.Spec.Submit, "submit", startSubmitTemplate)
 		if err != nil {
-			return cm, ctrl.Result{}, err
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "ConfigMapFailed", "Failed to generate submit script: %s", err)
+			return nil, err
 		}
 		data["start-manager"] = managerStart
 		data["start-execute"] = executeStart
 		data["start-submit"] = submitStart
 	}
-
-	// Create the config map with respective data!
-	cm = r.createConfigMap(cluster, configFullName, data)
-
-	// Actually create it
-	err := r.Create(ctx, cm)
-	if err != nil {
-		r.Log.Error(
-			err, "❌ Failed to create HTCondor ConfigMap",
-			"Type", configName,
-			"Namespace", cm.Namespace,
-			"Name", (*cm).Name,
-		)
-		return cm, ctrl.Result{}, err
-	}
-
-	// Successful - return and requeue
-	return cm, ctrl.Result{Requeue: true}, nil
+	return r.newConfigMap(cluster, configFullName, data), nil
 }
 
-// createConfigMap generates a config map with some kind of data
-func (r *HTCondorReconciler) createConfigMap(
+// newConfigMap generates a config map with some kind of data
+func (r *HTCondorReconciler) newConfigMap(
 	cluster *api.HTCondor,
 	configName string,
 	data map[string]string,
 ) *corev1.ConfigMap {
 
-	// Create the config map with respective data!
 	cm := &corev1.ConfigMap{
-		TypeMeta: metav1.TypeMeta{},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configName,
 			Namespace: cluster.Namespace,
 		},
 		Data: data,
 	}
-	// Finally create the config map
-	r.Log.Info(
-		"✨ Creating HTCondor ConfigMap ✨",
-		"Type", configName,
-		"Namespace", cm.Namespace,
-		"Name", cm.Name,
-	)
-	// Show in the logs
-	fmt.Println(cm.Data)
-	ctrl.SetControllerReference(cluster, cm, r.Scheme)
+
+	// Show in the logs when debugging
+	r.Log.V(1).Info("HTCondor ConfigMap data", "Name", cm.Name, "Data", cm.Data)
 	return cm
 }
 
-// ensureConfigMap ensures we've generated the read only entrypoints
+// ensureConfigMap applies the read only entrypoints
 func (r *HTCondorReconciler) ensureConfigMap(
 	ctx context.Context,
 	cluster *api.HTCondor,
@@ -222,35 +297,10 @@ func (r *HTCondorReconciler) ensureConfigMap(
 	configFullName string,
 ) (*corev1.ConfigMap, ctrl.Result, error) {
 
-	// Look for the config map by name
-	existing := &corev1.ConfigMap{}
-	err := r.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      configFullName,
-			Namespace: cluster.Namespace,
-		},
-		existing,
-	)
-
+	cm, err := r.getConfigMap(cluster, configName, configFullName)
 	if err != nil {
-
-		// Case 1: not found yet, and hostfile is ready (recreate)
-		if errors.IsNotFound(err) {
-			return r.getConfigMap(ctx, cluster, configName, configFullName)
-
-		} else if err != nil {
-			r.Log.Error(err, "Failed to get HTCondor ConfigMap")
-			return existing, ctrl.Result{}, err
-		}
-
-	} else {
-		r.Log.Info(
-			"🎉 Found existing HTCondor ConfigMap",
-			"Type", configName,
-			"Namespace", existing.Namespace,
-			"Name", existing.Name,
-		)
+		return cm, ctrl.Result{}, err
 	}
-	return existing, ctrl.Result{}, err
+	err = r.apply(ctx, cluster, cm)
+	return cm, ctrl.Result{}, err
 }
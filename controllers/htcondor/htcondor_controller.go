@@ -12,16 +12,24 @@ package controllers
 
 import (
 	"context"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/cri-api/pkg/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	jobset "sigs.k8s.io/jobset/api/v1alpha1"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
@@ -35,6 +43,15 @@ type HTCondorReconciler struct {
 	Log        logr.Logger
 	RESTClient rest.Interface
 	RESTConfig *rest.Config
+
+	// Events are recorded on the HTCondor for each lifecycle step
+	Recorder record.EventRecorder
+
+	// How often to query pools for metrics, 0 to disable
+	MetricsInterval time.Duration
+
+	// Images for an HTCondor version and base OS, DefaultImageCatalog if nil
+	Images *ImageCatalog
 }
 
 //+kubebuilder:rbac:groups=flux-framework.org,resources=htcondors,verbs=get;list;watch;create;update;patch;delete
@@ -100,30 +117,151 @@ func (r *HTCondorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	// Don't continue if they provided 0 size, that makes no sense!
 	if cluster.Spec.Size == 0 {
 		r.Log.Info("👑️ A HTCondor must have at least one node")
+		r.Recorder.Event(&cluster, corev1.EventTypeWarning, "InvalidSize", "A HTCondor must have at least one execute node")
 		return ctrl.Result{}, nil
 	}
 
 	// Show parameters provided and validate one flux runner
-	if !cluster.Validate() {
-		r.Log.Info("👑️ Your HTCondor config did not validate.")
-		return ctrl.Result{}, nil
+	err = cluster.Validate()
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "InvalidSpec", err)
+	}
+
+	// Images come from the catalog, unless a role sets its own
+	running, err := r.getRunningImages(ctx, &cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	catalog := r.Images
+	if catalog == nil {
+		catalog = &DefaultImageCatalog
+	}
+	err = resolveImages(&cluster, catalog, running)
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "UnknownImages", err)
+	}
+	err = r.updateImages(ctx, &cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// A bad quantity is reported on this HTCondor, and we wait for a fix
+	err = r.validateResources(&cluster)
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "InvalidResources", err)
+	}
+
+	// Init and sidecar containers can't share a name in the pod
+	err = validateContainerNames(&cluster)
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "InvalidContainers", err)
+	}
+
+	// Group quotas are checked against the size of the pool
+	err = validateAccounting(&cluster)
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "InvalidAccounting", err)
+	}
+
+	// External execute nodes need an address for the collector
+	err = validateAnnex(&cluster)
+	if err != nil {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "InvalidAnnex", err)
+	}
+	err = r.setCondition(ctx, &cluster, metav1.Condition{
+		Type:    api.ConditionValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Valid",
+		Message: "The spec is valid",
+	})
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
 	// Ensure we have the HTCondor cluster
 	result, err := r.ensureHTCondor(ctx, &cluster)
-	if err != nil {
+
+	// Anything else the API server rejects is a problem with the spec
+	if apierrors.IsInvalid(err) {
+		return ctrl.Result{}, r.setInvalid(ctx, &cluster, "Rejected", err)
+	}
+	if err != nil || result.Requeue || result.RequeueAfter > 0 {
 		return result, err
 	}
 
 	// By the time we get here we have a Job + pods + config maps!
-	// What else do we want to do?
+	// The pool is ready when all of the pods are running
+	ready, err := r.updateReady(ctx, &cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = r.updateStarted(ctx, &cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// A suspended pool waits for the JobSet to be resumed (or admitted)
+	if meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended) {
+		r.Log.Info("👑️ HTCondor is suspended")
+		return ctrl.Result{}, nil
+	}
+	// Running pods can still be waiting in their start scripts to join the pool
+	if !ready || !meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionStarted) {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
 	r.Log.Info("👑️ HTCondor is Ready!")
 
-	return ctrl.Result{}, nil
+	// Highly available managers can fail over, so keep checking
+	if cluster.Spec.HighAvailability() {
+		err = r.updateActiveNegotiator(ctx, &cluster)
+		if err != nil {
+			r.Log.Info("🗳️ Could not find the active negotiator", "Reason", err.Error())
+		}
+	}
+
+	// The version actually running can differ from the catalog for an override
+	err = r.updateCondorVersion(ctx, &cluster)
+	if err != nil {
+		r.Log.Info("🏷️ Could not detect the HTCondor version", "Reason", err.Error())
+	}
+
+	// Schedd queue totals are shown in status
+	err = r.updateSchedds(ctx, &cluster)
+	if err != nil {
+		r.Log.Info("📋 Could not update the schedds", "Reason", err.Error())
+	}
+
+	// Keep checking on the schedds, external execute nodes, and negotiator failover
+	return ctrl.Result{RequeueAfter: time.Minute}, nil
+}
+
+// setInvalid reports a spec that can't be turned into resources, and we wait for a fix
+func (r *HTCondorReconciler) setInvalid(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	reason string,
+	err error,
+) error {
+	r.Log.Info("👑️ Your HTCondor spec did not validate.", "Reason", reason, "Error", err.Error())
+	r.Recorder.Event(cluster, corev1.EventTypeWarning, reason, err.Error())
+	return r.setCondition(ctx, cluster, metav1.Condition{
+		Type:    api.ConditionValid,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HTCondorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	// Pool metrics are collected alongside reconciling
+	if r.MetricsInterval > 0 {
+		err := mgr.Add(manager.RunnableFunc(r.collectPoolMetrics))
+		if err != nil {
+			return err
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&api.HTCondor{}).
 
@@ -134,7 +272,14 @@ func (r *HTCondorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&corev1.Service{}).
 		Owns(&corev1.Pod{}).
 		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&jobset.JobSet{}).
 		Owns(&batchv1.Job{}).
+
+		// Pools re-render flocking config when their peers come and go
+		Watches(
+			&source.Kind{Type: &api.HTCondor{}},
+			handler.EnqueueRequestsFromMapFunc(r.findFlockingPools),
+		).
 		Complete(r)
 }
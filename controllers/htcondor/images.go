@@ -0,0 +1,261 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	jobset "sigs.k8s.io/jobset/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// ImageCatalog maps an HTCondor version and base OS to a vetted image set
+type ImageCatalog struct {
+
+	// Used when the HTCondor does not ask for a version or base OS
+	DefaultVersion string `json:"defaultVersion"`
+	DefaultBaseOS  string `json:"defaultBaseOS"`
+
+	// Images for each role, by version and then base OS
+	Versions map[string]map[string]api.Images `json:"versions"`
+}
+
+// DefaultImageCatalog is used when the operator is not given a catalog
+var DefaultImageCatalog = ImageCatalog{
+	DefaultVersion: "23.0",
+	DefaultBaseOS:  "el8",
+	Versions: map[string]map[string]api.Images{
+		"10.0": {
+			"el7": newImages("10.0-el7"),
+			"el8": newImages("10.0-el8"),
+		},
+		"23.0": {
+			"el8": newImages("23.0-el8"),
+			"el9": newImages("23.0-el9"),
+		},
+	},
+}
+
+// newImages is the image set for an htcondor/* tag
+func newImages(tag string) api.Images {
+	return api.Images{
+		Manager: "htcondor/cm:" + tag,
+		Submit:  "htcondor/submit:" + tag,
+		Execute: "htcondor/execute:" + tag,
+	}
+}
+
+// LoadImageCatalog reads a catalog from a file, e.g., a mounted ConfigMap
+func LoadImageCatalog(path string) (*ImageCatalog, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	catalog := ImageCatalog{}
+	err = yaml.UnmarshalStrict(content, &catalog)
+	if err != nil {
+		return nil, fmt.Errorf("image catalog %s: %s", path, err)
+	}
+	if _, err := catalog.Lookup(catalog.DefaultVersion, catalog.DefaultBaseOS); err != nil {
+		return nil, fmt.Errorf("image catalog %s: default %s", path, err)
+	}
+
+	// Every entry is a full image set, so a pool never runs without an image
+	for _, version := range sortedKeys(catalog.Versions) {
+		for _, baseOS := range sortedKeys(catalog.Versions[version]) {
+			images := catalog.Versions[version][baseOS]
+			for _, role := range []struct{ name, image string }{
+				{"manager", images.Manager},
+				{"submit", images.Submit},
+				{"execute", images.Execute},
+			} {
+				if role.image == "" {
+					return nil, fmt.Errorf("image catalog %s: %s %s has no %s image", path, version, baseOS, role.name)
+				}
+			}
+		}
+	}
+	return &catalog, nil
+}
+
+// Lookup finds the image set for a version and base OS
+func (c *ImageCatalog) Lookup(version, baseOS string) (api.Images, error) {
+	bases, ok := c.Versions[version]
+	if !ok {
+		return api.Images{}, fmt.Errorf("htcondorVersion: %q is not in the image catalog (%s)", version, strings.Join(sortedKeys(c.Versions), ", "))
+	}
+	images, ok := bases[baseOS]
+	if !ok {
+		return api.Images{}, fmt.Errorf("baseOS: %q is not in the image catalog for %s (%s)", baseOS, version, strings.Join(sortedKeys(bases), ", "))
+	}
+	return images, nil
+}
+
+// find is the entry a pool is running, from the image of any of its roles
+func (c *ImageCatalog) find(running api.Images) (string, string, bool) {
+	for _, version := range sortedKeys(c.Versions) {
+		for _, baseOS := range sortedKeys(c.Versions[version]) {
+			images := c.Versions[version][baseOS]
+			if (running.Manager != "" && running.Manager == images.Manager) ||
+				(running.Submit != "" && running.Submit == images.Submit) ||
+				(running.Execute != "" && running.Execute == images.Execute) {
+				return version, baseOS, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// sortedKeys lists catalog entries for an error message
+func sortedKeys[T any](entries map[string]T) []string {
+	keys := []string{}
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getRunningImages finds the image each role runs in the JobSet, if it exists
+func (r *HTCondorReconciler) getRunningImages(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (api.Images, error) {
+
+	images := api.Images{}
+	job := &jobset.JobSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, job)
+	if errors.IsNotFound(err) {
+		return images, nil
+	}
+	if err != nil {
+		return images, err
+	}
+	roles := map[string]*string{
+		"manager": &images.Manager,
+		"submit":  &images.Submit,
+		"execute": &images.Execute,
+	}
+	for _, replicatedJob := range job.Spec.ReplicatedJobs {
+		image, ok := roles[replicatedJob.Name]
+		if !ok {
+			continue
+		}
+		for _, container := range replicatedJob.Template.Spec.Template.Spec.Containers {
+			if container.Name == replicatedJob.Name+"-node" {
+				*image = container.Image
+			}
+		}
+	}
+	return images, nil
+}
+
+// resolveImages fills in the image for each role that does not set its own.
+// A pool that follows the catalog defaults keeps the entry it is running,
+// so a new default (e.g., on an operator upgrade) doesn't recreate it.
+// Running images that aren't in the catalog, e.g., from an override that
+// was removed, are not kept. The catalog is only required when a role needs it
+func resolveImages(cluster *api.HTCondor, catalog *ImageCatalog, running api.Images) error {
+	if cluster.Spec.HTCondorVersion == "" && cluster.Spec.BaseOS == "" {
+		if version, baseOS, ok := catalog.find(running); ok {
+			cluster.Spec.HTCondorVersion = version
+			cluster.Spec.BaseOS = baseOS
+		}
+	}
+	if cluster.Spec.HTCondorVersion == "" {
+		cluster.Spec.HTCondorVersion = catalog.DefaultVersion
+	}
+	if cluster.Spec.BaseOS == "" {
+		cluster.Spec.BaseOS = catalog.DefaultBaseOS
+	}
+	if cluster.Spec.Manager.Image != "" && cluster.Spec.Submit.Image != "" && cluster.Spec.Execute.Image != "" {
+		return nil
+	}
+
+	images, err := catalog.Lookup(cluster.Spec.HTCondorVersion, cluster.Spec.BaseOS)
+	if err != nil {
+		return err
+	}
+	if cluster.Spec.Manager.Image == "" {
+		cluster.Spec.Manager.Image = images.Manager
+	}
+	if cluster.Spec.Submit.Image == "" {
+		cluster.Spec.Submit.Image = images.Submit
+	}
+	if cluster.Spec.Execute.Image == "" {
+		cluster.Spec.Execute.Image = images.Execute
+	}
+	return nil
+}
+
+// updateImages shows the resolved image for each role in status
+func (r *HTCondorReconciler) updateImages(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) error {
+
+	images := api.Images{
+		Manager: cluster.Spec.Manager.Image,
+		Submit:  cluster.Spec.Submit.Image,
+		Execute: cluster.Spec.Execute.Image,
+	}
+	if images == cluster.Status.Images {
+		return nil
+	}
+	cluster.Status.Images = images
+	return r.Status().Update(ctx, cluster)
+}
+
+// updateCondorVersion shows the version the central manager is running,
+// which can differ from the catalog for an image override
+func (r *HTCondorReconciler) updateCondorVersion(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) error {
+
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return err
+	}
+	out, err := r.execPod(ctx, manager, "manager-node", []string{"condor_version"})
+	if err != nil {
+		return err
+	}
+	version, err := parseCondorVersion(out)
+	if err != nil {
+		return err
+	}
+	if version == cluster.Status.CondorVersion {
+		return nil
+	}
+	cluster.Status.CondorVersion = version
+	return r.Status().Update(ctx, cluster)
+}
+
+// parseCondorVersion gets the version from condor_version output, e.g.,
+// $CondorVersion: 23.0.3 2024-01-04 BuildID: 700000 PackageID: 23.0.3-1 $
+func parseCondorVersion(out string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "$CondorVersion:" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("no $CondorVersion in condor_version output")
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+func TestImageCatalogLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		baseOS  string
+		want    api.Images
+		wantErr bool
+	}{
+		{
+			name:    "default",
+			version: DefaultImageCatalog.DefaultVersion,
+			baseOS:  DefaultImageCatalog.DefaultBaseOS,
+			want:    newImages("23.0-el8"),
+		},
+		{
+			name:    "older version",
+			version: "10.0",
+			baseOS:  "el7",
+			want:    newImages("10.0-el7"),
+		},
+		{
+			name:    "unknown version",
+			version: "8.9",
+			baseOS:  "el8",
+			wantErr: true,
+		},
+		{
+			name:    "unknown base OS for the version",
+			version: "23.0",
+			baseOS:  "el7",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DefaultImageCatalog.Lookup(test.version, test.baseOS)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveImages(t *testing.T) {
+	running := newImages("10.0-el7")
+	tests := []struct {
+		name    string
+		spec    api.HTCondorSpec
+		running api.Images
+		want    api.Images
+		wantErr bool
+	}{
+		{
+			name: "new pool gets the catalog default",
+			want: newImages("23.0-el8"),
+		},
+		{
+			name:    "running pool keeps its images",
+			running: running,
+			want:    running,
+		},
+		{
+			name: "a removed override goes back to the running catalog entry",
+			running: api.Images{
+				Manager: "htcondor/cm:10.0-el7",
+				Submit:  "htcondor/submit:10.0-el7",
+				Execute: "example/execute:custom",
+			},
+			want: running,
+		},
+		{
+			name:    "running images that are not in the catalog are not kept",
+			running: api.Images{Manager: "example/cm", Submit: "example/submit", Execute: "example/execute"},
+			want:    newImages("23.0-el8"),
+		},
+		{
+			name:    "running pool moves to a version that is asked for",
+			spec:    api.HTCondorSpec{HTCondorVersion: "23.0", BaseOS: "el9"},
+			running: running,
+			want:    newImages("23.0-el9"),
+		},
+		{
+			name: "a role can override its image",
+			spec: api.HTCondorSpec{Execute: api.Node{Image: "example/execute:custom"}},
+			want: api.Images{
+				Manager: "htcondor/cm:23.0-el8",
+				Submit:  "htcondor/submit:23.0-el8",
+				Execute: "example/execute:custom",
+			},
+		},
+		{
+			name:    "unknown version",
+			spec:    api.HTCondorSpec{HTCondorVersion: "8.9"},
+			wantErr: true,
+		},
+		{
+			name: "unknown version is fine when every role has an image",
+			spec: api.HTCondorSpec{
+				HTCondorVersion: "8.9",
+				Manager:         api.Node{Image: "example/cm"},
+				Submit:          api.Node{Image: "example/submit"},
+				Execute:         api.Node{Image: "example/execute"},
+			},
+			want: api.Images{Manager: "example/cm", Submit: "example/submit", Execute: "example/execute"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := &api.HTCondor{Spec: test.spec}
+			err := resolveImages(cluster, &DefaultImageCatalog, test.running)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := api.Images{
+				Manager: cluster.Spec.Manager.Image,
+				Submit:  cluster.Spec.Submit.Image,
+				Execute: cluster.Spec.Execute.Image,
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadImageCatalog(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid catalog",
+			content: `defaultVersion: "23.0"
+defaultBaseOS: el9
+versions:
+  "23.0":
+    el9:
+      manager: registry.example.com/cm:23.0-el9
+      submit: registry.example.com/submit:23.0-el9
+      execute: registry.example.com/execute:23.0-el9
+`,
+		},
+		{
+			name: "default is not in the catalog",
+			content: `defaultVersion: "24.0"
+defaultBaseOS: el9
+versions:
+  "23.0":
+    el9:
+      manager: registry.example.com/cm:23.0-el9
+`,
+			wantErr: true,
+		},
+		{
+			name: "an entry is missing a role",
+			content: `defaultVersion: "23.0"
+defaultBaseOS: el9
+versions:
+  "23.0":
+    el9:
+      manager: registry.example.com/cm:23.0-el9
+      submit: registry.example.com/submit:23.0-el9
+      execute: registry.example.com/execute:23.0-el9
+    el8:
+      manager: registry.example.com/cm:23.0-el8
+      execute: registry.example.com/execute:23.0-el8
+`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			content: "defaultVersion: \"23.0\"\nimages: {}\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "catalog.yaml")
+			err := os.WriteFile(path, []byte(test.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = LoadImageCatalog(path)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCondorVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "condor_version output",
+			out:  "$CondorVersion: 23.0.3 2024-01-04 BuildID: 700000 PackageID: 23.0.3-1 $\n$CondorPlatform: x86_64_AlmaLinux8 $\n",
+			want: "23.0.3",
+		},
+		{
+			name:    "no version",
+			out:     "condor_version: command not found\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCondorVersion(test.out)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
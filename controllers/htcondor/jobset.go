@@ -11,16 +11,37 @@ SPDX-License-Identifier: Apache-2.0
 package controllers
 
 import (
+	"context"
+	"fmt"
+
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	jobset "sigs.k8s.io/jobset/api/v1alpha1"
 )
 
+const (
+	// queueNameLabel tells Kueue which LocalQueue the JobSet waits in
+	queueNameLabel = "kueue.x-k8s.io/queue-name"
+
+	// suspendFieldManager owns suspend for a queued JobSet, so the operator
+	// can suspend it without taking the field away from Kueue
+	suspendFieldManager = "htcondor-operator-suspend"
+)
+
+// wantSuspended is true when the pool is suspended by the spec
+// A paused pool is only suspended after it is drained and checkpointed
+func wantSuspended(cluster *api.HTCondor) bool {
+	return cluster.Spec.Suspend ||
+		(cluster.Spec.Paused && meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionPaused))
+}
+
 // newJobSet creates the jobset for the HTCondor
 func (r *HTCondorReconciler) newJobSet(
 	cluster *api.HTCondor,
@@ -29,12 +50,11 @@ func (r *HTCondorReconciler) newJobSet(
 	// When we have a success policy
 	// serverName := cluster.Name + "-server"
 
-	// When suspend is true we have a hard time debugging jobs, so keep false
-	suspend := false
 	jobs := jobset.JobSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cluster.Name,
 			Namespace: cluster.Namespace,
+			Labels:    map[string]string{},
 		},
 		Spec: jobset.JobSetSpec{
 
@@ -43,28 +63,36 @@ func (r *HTCondorReconciler) newJobSet(
 			//	Operator:             jobset.OperatorAny,
 			//	TargetReplicatedJobs: []string{serverName},
 			//},
+
+			// Any node job failing (e.g., the manager) restarts or fails the pool
 			FailurePolicy: &jobset.FailurePolicy{
-				MaxRestarts: 0,
+				MaxRestarts: int(cluster.Spec.FailurePolicy.MaxRestarts),
 			},
-
-			// This might be the control for child jobs (worker)
-			// But I don't think we need this anymore.
-			Suspend: &suspend,
 		},
 	}
 
+	// A queued pool is suspended by Kueue until it is admitted, so we only
+	// own suspend when there is no queue (see applySuspend)
+	if cluster.Spec.QueueName != "" {
+		jobs.Labels[queueNameLabel] = cluster.Spec.QueueName
+	} else {
+		suspend := wantSuspended(cluster)
+		jobs.Spec.Suspend = &suspend
+	}
+
 	// Get manager job, the parent in the JobSet
-	managerJob, err := r.getJob(cluster, cluster.Spec.Manager, 1, "manager", true)
+	managerJob, err := r.getJob(cluster, cluster.Spec.Manager, cluster.Spec.Manager.Replicas, "manager", true)
 	if err != nil {
 		r.Log.Error(err, "There was an error getting the manager ReplicatedJob")
 		return &jobs, err
 	}
 
-	submitJob, err := r.getJob(cluster, cluster.Spec.Submit, 1, "submit", true)
+	scheddJobs, err := r.getScheddJobs(cluster)
 	if err != nil {
 		r.Log.Error(err, "There was an error getting the submit ReplicatedJob")
 		return &jobs, err
 	}
+	jobs.Spec.ReplicatedJobs = append([]jobset.ReplicatedJob{managerJob}, scheddJobs...)
 
 	// Create a cluster (JobSet) with or without workers
 	if cluster.Spec.Size > 0 {
@@ -73,15 +101,70 @@ func (r *HTCondorReconciler) newJobSet(
 			r.Log.Error(err, "There was an error getting the worker ReplicatedJob")
 			return &jobs, err
 		}
-		jobs.Spec.ReplicatedJobs = []jobset.ReplicatedJob{managerJob, submitJob, executeJob}
-
-	} else {
-		jobs.Spec.ReplicatedJobs = []jobset.ReplicatedJob{managerJob, submitJob}
+		jobs.Spec.ReplicatedJobs = append(jobs.Spec.ReplicatedJobs, executeJob)
 	}
 	ctrl.SetControllerReference(cluster, &jobs, r.Scheme)
 	return &jobs, nil
 }
 
+// getScheddJobName is the replicated job for a schedd. The first schedd
+// is the submit job, so a pool with one schedd looks as it always has
+func getScheddJobName(index int32) string {
+	if index == 0 {
+		return "submit"
+	}
+	return fmt.Sprintf("submit-%d", index)
+}
+
+// getScheddJobs creates a replicated job for each schedd. A JobSet has one
+// pod template per replicated job, so this is how each schedd mounts its
+// own spool
+func (r *HTCondorReconciler) getScheddJobs(cluster *api.HTCondor) ([]jobset.ReplicatedJob, error) {
+	jobs := []jobset.ReplicatedJob{}
+	for i := int32(0); i < cluster.Spec.Submit.Replicas; i++ {
+		job, err := r.getJob(cluster, cluster.Spec.Submit, 1, "submit", true)
+		if err != nil {
+			return jobs, err
+		}
+		if i > 0 {
+			setScheddIndex(cluster, &job, i)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// setScheddIndex renames a submit job for another schedd, with its own spool
+// The first schedd gets its index from the job index label, which is always
+// 0 here, so the index is set directly
+func setScheddIndex(cluster *api.HTCondor, job *jobset.ReplicatedJob, index int32) {
+	job.Name = getScheddJobName(index)
+	spec := &job.Template.Spec.Template.Spec
+	for i, volume := range spec.Volumes {
+		if volume.Name == getSpoolName(cluster, 0) {
+			spec.Volumes[i] = getSpoolVolume(cluster, index)
+		}
+	}
+	setContainer := func(container *corev1.Container) {
+		for i, mount := range container.VolumeMounts {
+			if mount.Name == getSpoolName(cluster, 0) {
+				container.VolumeMounts[i] = getSpoolVolumeMount(cluster, index)
+			}
+		}
+		for i, env := range container.Env {
+			if env.Name == "HTCONDOR_SCHEDD_INDEX" {
+				container.Env[i] = corev1.EnvVar{Name: env.Name, Value: fmt.Sprintf("%d", index)}
+			}
+		}
+	}
+	for i := range spec.Containers {
+		setContainer(&spec.Containers[i])
+	}
+	for i := range spec.InitContainers {
+		setContainer(&spec.InitContainers[i])
+	}
+}
+
 // getJob creates a job for a main leader (broker) or worker (followers)
 func (r *HTCondorReconciler) getJob(
 	cluster *api.HTCondor,
@@ -91,7 +174,6 @@ func (r *HTCondorReconciler) getJob(
 	indexed bool,
 ) (jobset.ReplicatedJob, error) {
 
-	backoffLimit := int32(100)
 	podLabels := r.getPodLabels(cluster)
 	enableDNSHostnames := false
 	completionMode := batchv1.NonIndexedCompletion
@@ -123,7 +205,7 @@ func (r *HTCondorReconciler) getJob(
 
 	// Create the JobSpec for the job -> Template -> Spec
 	jobspec := batchv1.JobSpec{
-		BackoffLimit:          &backoffLimit,
+		BackoffLimit:          node.BackoffLimit,
 		Completions:           &size,
 		Parallelism:           &size,
 		CompletionMode:        &completionMode,
@@ -140,7 +222,7 @@ func (r *HTCondorReconciler) getJob(
 				// matches the service
 				Subdomain:     cluster.Spec.ServiceName,
 				Volumes:       getVolumes(cluster),
-				RestartPolicy: corev1.RestartPolicyOnFailure,
+				RestartPolicy: node.RestartPolicy,
 			},
 		},
 	}
@@ -152,17 +234,34 @@ func (r *HTCondorReconciler) getJob(
 		}
 	}
 
-	// Get resources for the node (server or worker)
-	resources, err := r.getNodeResources(cluster, node)
-	r.Log.Info("👑️ HTCondor", "Pod.Resources", resources)
-	if err != nil {
-		r.Log.Error(err, "❌ HTCondor", "Pod.Resources", resources)
-		return job, err
+	// Pod overhead comes from the RuntimeClass, if there is one
+	runtimeClassName := cluster.Spec.RuntimeClassName
+	if node.RuntimeClassName != "" {
+		runtimeClassName = node.RuntimeClassName
+	}
+	if runtimeClassName != "" {
+		jobspec.Template.Spec.RuntimeClassName = &runtimeClassName
 	}
-	jobspec.Template.Spec.Overhead = resources
 
 	// Get volume mounts, add on container specific ones
 	mounts := getVolumeMounts(cluster)
+
+	// The schedd queue is kept on a persistent spool
+	if entrypoint == "submit" && cluster.Spec.Spool.Size != "" {
+		jobspec.Template.Spec.Volumes = append(jobspec.Template.Spec.Volumes, getSpoolVolume(cluster, 0))
+		mounts = append(mounts, getSpoolVolumeMount(cluster, 0))
+	}
+	if entrypoint == "manager" && cluster.Spec.HighAvailability() {
+		jobspec.Template.Spec.Volumes = append(jobspec.Template.Spec.Volumes, getManagerStateVolume(cluster))
+		mounts = append(mounts, getManagerStateVolumeMount(cluster))
+	}
+
+	// Jobs in container images need scratch space, and maybe a docker daemon
+	if entrypoint == "execute" && node.ContainerUniverse != "" {
+		jobspec.Template.Spec.Volumes = append(jobspec.Template.Spec.Volumes, getUniverseVolumes(cluster, node)...)
+		mounts = append(mounts, getUniverseVolumeMounts(cluster, node)...)
+		jobspec.Template.ObjectMeta.Annotations = getUniverseAnnotations(node, entrypoint)
+	}
 	containers, err := r.getContainers(
 		cluster,
 		node,
@@ -171,10 +270,96 @@ func (r *HTCondorReconciler) getJob(
 	)
 	// Error creating containers
 	if err != nil {
-		r.Log.Error(err, "❌ HTCondor", "Pod.Resources", resources)
+		r.Log.Error(err, "❌ HTCondor", "Pod.Containers", entrypoint)
+		return job, err
+	}
+
+	// Sidecars run alongside the HTCondor node container
+	sidecars, err := r.getExtraContainers(node.Sidecars, mounts, "spec."+entrypoint+".sidecars")
+	if err != nil {
+		r.Log.Error(err, "❌ HTCondor", "Pod.Sidecars", node.Sidecars)
+		return job, err
+	}
+	jobspec.Template.Spec.Containers = append(containers, sidecars...)
+	if entrypoint == "execute" && node.ContainerUniverse == "docker" {
+		jobspec.Template.Spec.Containers = append(jobspec.Template.Spec.Containers, getDockerContainer(cluster))
+	}
+
+	// Init containers run before, e.g., to stage data or credentials
+	initContainers, err := r.getExtraContainers(node.InitContainers, mounts, "spec."+entrypoint+".initContainers")
+	if err != nil {
+		r.Log.Error(err, "❌ HTCondor", "Pod.InitContainers", node.InitContainers)
 		return job, err
 	}
-	jobspec.Template.Spec.Containers = containers
+	if entrypoint == "execute" && node.ContainerUniverse == "docker" {
+		initContainers = append(initContainers, getDockerClientContainer(cluster))
+	}
+	jobspec.Template.Spec.InitContainers = initContainers
 	job.Template.Spec = jobspec
 	return job, err
 }
+
+// applySuspend suspends a queued JobSet with its own field manager. When the
+// pool is resumed the field is left for Kueue, which unsuspends it once the
+// pool is admitted, instead of being removed by the next apply
+func (r *HTCondorReconciler) applySuspend(
+	ctx context.Context,
+	job *jobset.JobSet,
+) error {
+
+	suspend := true
+	patch := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace},
+		Spec:       jobset.JobSetSpec{Suspend: &suspend},
+	}
+	patch.SetGroupVersionKind(job.GroupVersionKind())
+	err := r.Patch(ctx, patch, client.Apply, client.FieldOwner(suspendFieldManager), client.ForceOwnership)
+	if err != nil {
+		return err
+	}
+	job.Spec.Suspend = patch.Spec.Suspend
+	return nil
+}
+
+// updateSuspended sets the Suspended condition from the applied JobSet
+// A suspended pool is waiting, and not pending on pods being scheduled
+func (r *HTCondorReconciler) updateSuspended(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	job *jobset.JobSet,
+) error {
+
+	suspended := job.Spec.Suspend != nil && *job.Spec.Suspend
+	condition := metav1.Condition{
+		Type:    api.ConditionSuspended,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Running",
+		Message: "The JobSet is not suspended",
+	}
+	if suspended && cluster.Spec.Suspend {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Suspended"
+		condition.Message = "The pool is suspended by spec.suspend"
+	} else if suspended && cluster.Spec.Paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Paused"
+		condition.Message = "The pool is paused, with the queue on the spool"
+	} else if suspended {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Queued"
+		condition.Message = fmt.Sprintf("The pool is waiting to be admitted from queue %s", cluster.Spec.QueueName)
+	} else if cluster.Spec.QueueName != "" {
+		condition.Reason = "Admitted"
+		condition.Message = fmt.Sprintf("The pool was admitted from queue %s", cluster.Spec.QueueName)
+	}
+
+	// Only record an event when the pool changes to or from suspended
+	if suspended != meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended) {
+		if suspended {
+			r.Recorder.Event(cluster, corev1.EventTypeNormal, "PoolSuspended", condition.Message)
+		} else if meta.FindStatusCondition(cluster.Status.Conditions, api.ConditionSuspended) != nil {
+			r.Recorder.Event(cluster, corev1.EventTypeNormal, "PoolResumed", condition.Message)
+		}
+	}
+	return r.setCondition(ctx, cluster, condition)
+}
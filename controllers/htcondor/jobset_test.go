@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+func TestGetScheddJobs(t *testing.T) {
+	cluster := &api.HTCondor{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"},
+		Spec: api.HTCondorSpec{
+			Submit: api.Node{Image: "htcondor/submit:23.0-el8", Replicas: 3},
+			Spool:  api.Storage{Size: "1Gi"},
+		},
+	}
+	r := &HTCondorReconciler{}
+	jobs, err := r.getScheddJobs(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		claim string
+		index string
+	}{
+		// The first schedd keeps its job, claim and index label
+		{name: "submit", claim: "pool-spool"},
+		{name: "submit-1", claim: "pool-spool-1", index: "1"},
+		{name: "submit-2", claim: "pool-spool-2", index: "2"},
+	}
+	if len(jobs) != len(tests) {
+		t.Fatalf("got %d jobs, want %d", len(jobs), len(tests))
+	}
+	for i, tt := range tests {
+		job := jobs[i]
+		if job.Name != tt.name {
+			t.Errorf("job %d: got name %q, want %q", i, job.Name, tt.name)
+		}
+		spec := job.Template.Spec.Template.Spec
+		claims := []string{}
+		for _, volume := range spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+			}
+		}
+		if len(claims) != 1 || claims[0] != tt.claim {
+			t.Errorf("%s: got claims %v, want [%s]", tt.name, claims, tt.claim)
+		}
+		var container corev1.Container
+		for _, c := range spec.Containers {
+			if c.Name == "submit-node" {
+				container = c
+			}
+		}
+		mounted := false
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == tt.claim && mount.MountPath == spoolPath {
+				mounted = true
+			}
+		}
+		if !mounted {
+			t.Errorf("%s: %s is not mounted at %s", tt.name, tt.claim, spoolPath)
+		}
+		for _, env := range container.Env {
+			if env.Name != "HTCONDOR_SCHEDD_INDEX" {
+				continue
+			}
+			if tt.index == "" && env.ValueFrom == nil {
+				t.Errorf("%s: index should come from the job index label", tt.name)
+			}
+			if tt.index != "" && (env.Value != tt.index || env.ValueFrom != nil) {
+				t.Errorf("%s: got index %q, want %q", tt.name, env.Value, tt.index)
+			}
+		}
+	}
+}
+
+func TestGetScheddHosts(t *testing.T) {
+	cluster := &api.HTCondor{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"},
+		Spec: api.HTCondorSpec{
+			Submit:        api.Node{Replicas: 2},
+			ServiceName:   "htc",
+			ClusterDomain: "cluster.local",
+		},
+	}
+	want := []string{
+		"pool-submit-0-0.htc.default.svc.cluster.local",
+		"pool-submit-1-0-0.htc.default.svc.cluster.local",
+	}
+	got := getScheddHosts(cluster)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// Pool metrics are labeled by the HTCondor name and namespace
+var (
+	poolLabels = []string{"name", "namespace"}
+
+	slotsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "htcondor_slots",
+			Help: "Slots registered with the collector, by state",
+		},
+		append(poolLabels, "state"),
+	)
+	jobsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "htcondor_jobs",
+			Help: "Jobs across the schedds of the pool, by status",
+		},
+		append(poolLabels, "status"),
+	)
+	negotiatorCycleGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "htcondor_negotiator_cycle_seconds",
+			Help: "Duration of the last negotiator cycle",
+		},
+		poolLabels,
+	)
+	poolSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "htcondor_pool_size",
+			Help: "Execute nodes (machines) registered with the collector",
+		},
+		poolLabels,
+	)
+)
+
+func init() {
+	// This is the registry served on the manager metrics endpoint
+	metrics.Registry.MustRegister(slotsGauge, jobsGauge, negotiatorCycleGauge, poolSizeGauge)
+}
+
+// collectPoolMetrics queries the collector of each pool on an interval
+// This is run by the manager, and stops when the manager does
+func (r *HTCondorReconciler) collectPoolMetrics(ctx context.Context) error {
+	ticker := time.NewTicker(r.MetricsInterval)
+	defer ticker.Stop()
+
+	// Remember pools so we can remove metrics for deleted ones
+	seen := map[string]prometheus.Labels{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		pools := &api.HTCondorList{}
+		err := r.List(ctx, pools)
+		if err != nil {
+			r.Log.Error(err, "❌ Failed to list HTCondor pools for metrics")
+			continue
+		}
+		current := map[string]prometheus.Labels{}
+		for i := range pools.Items {
+			cluster := &pools.Items[i]
+			labels := prometheus.Labels{"name": cluster.Name, "namespace": cluster.Namespace}
+			current[cluster.Namespace+"/"+cluster.Name] = labels
+			r.updatePoolMetrics(ctx, cluster, labels)
+		}
+		for key, labels := range seen {
+			if _, ok := current[key]; !ok {
+				deletePoolMetrics(labels)
+			}
+		}
+		seen = current
+	}
+}
+
+// updatePoolMetrics queries one pool, leaving metrics alone if it can't
+func (r *HTCondorReconciler) updatePoolMetrics(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	labels prometheus.Labels,
+) {
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return
+	}
+
+	// Slots by state, and the number of machines they are on
+	slots, err := r.execPod(ctx, manager, "manager-node", []string{
+		"condor_status", "-startd", "-af", "Machine", "State",
+	})
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to query HTCondor collector for slots", "Name", cluster.Name)
+		return
+	}
+
+	// The schedd ads in the collector have the job totals
+	jobs, err := r.execPod(ctx, manager, "manager-node", []string{
+		"condor_status", "-schedd", "-af", "TotalIdleJobs", "TotalRunningJobs", "TotalHeldJobs",
+	})
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to query HTCondor collector for jobs", "Name", cluster.Name)
+		return
+	}
+	negotiator, err := r.execPod(ctx, manager, "manager-node", []string{
+		"condor_status", "-negotiator", "-af", "LastNegotiationCycleDuration0",
+	})
+	if err != nil {
+		r.Log.Error(err, "❌ Failed to query HTCondor collector for the negotiator", "Name", cluster.Name)
+		return
+	}
+
+	// Slot states differ between queries, so start fresh
+	deletePoolMetrics(labels)
+
+	machines := map[string]bool{}
+	states := map[string]float64{}
+	for _, line := range strings.Split(slots, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		machines[fields[0]] = true
+		states[fields[1]]++
+	}
+	for state, count := range states {
+		slotsGauge.With(withLabel(labels, "state", state)).Set(count)
+	}
+	poolSizeGauge.With(labels).Set(float64(len(machines)))
+
+	// Sum the totals across schedds
+	totals := []float64{0, 0, 0}
+	for _, line := range strings.Split(jobs, "\n") {
+		for i, field := range strings.Fields(line) {
+			value, err := strconv.ParseFloat(field, 64)
+			if err == nil && i < len(totals) {
+				totals[i] += value
+			}
+		}
+	}
+	for i, status := range []string{"idle", "running", "held"} {
+		jobsGauge.With(withLabel(labels, "status", status)).Set(totals[i])
+	}
+
+	// Undefined until the negotiator has finished a cycle
+	duration, err := strconv.ParseFloat(strings.TrimSpace(negotiator), 64)
+	if err == nil {
+		negotiatorCycleGauge.With(labels).Set(duration)
+	}
+}
+
+// withLabel copies pool labels, adding one more
+func withLabel(labels prometheus.Labels, key, value string) prometheus.Labels {
+	copied := prometheus.Labels{key: value}
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// deletePoolMetrics removes all metrics for one pool
+func deletePoolMetrics(labels prometheus.Labels) {
+	slotsGauge.DeletePartialMatch(labels)
+	jobsGauge.DeletePartialMatch(labels)
+	negotiatorCycleGauge.Delete(labels)
+	poolSizeGauge.Delete(labels)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// ensurePaused drains and checkpoints a paused pool so it can be suspended,
+// and tracks a resumed pool as it comes back up
+func (r *HTCondorReconciler) ensurePaused(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
+
+	condition := meta.FindStatusCondition(cluster.Status.Conditions, api.ConditionPaused)
+	if cluster.Spec.Paused {
+		if condition != nil && condition.Status == metav1.ConditionTrue {
+			return ctrl.Result{}, nil
+		}
+		return r.pausePool(ctx, cluster)
+	}
+
+	// The pool was never paused, or is done resuming
+	if condition == nil || condition.Reason == "Resumed" {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.resumePool(ctx, cluster, condition)
+}
+
+// pausePool peacefully shuts down the execute nodes, so running jobs finish,
+// and then gracefully shuts down the schedd, so the queue is on the spool
+func (r *HTCondorReconciler) pausePool(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
+
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+
+		// There is nothing running to drain, e.g., the pool was suspended
+		if meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended) {
+			err = r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionTrue, "Paused", "The pool was paused while suspended")
+			return ctrl.Result{Requeue: true}, err
+		}
+		r.Log.Info("⏸️ Waiting for the manager to pause the pool", "Reason", err.Error())
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	// The startds exit when their running jobs are done
+	err = r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "Draining", "Waiting for running jobs to finish on execute nodes")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	_, err = r.execPod(ctx, manager, "manager-node", []string{"condor_off", "-all", "-peaceful", "-startd"})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	startds, err := r.execPod(ctx, manager, "manager-node", []string{"condor_status", "-startd", "-af", "Machine"})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if strings.TrimSpace(startds) != "" {
+		r.Log.Info("⏸️ Waiting for execute nodes to drain", "Name", cluster.Name)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Each schedd writes its queue to the spool when it shuts down
+	err = r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "Checkpointing", "Shutting down the schedds to checkpoint the queue")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	_, err = r.execPod(ctx, manager, "manager-node", []string{"condor_off", "-all", "-graceful", "-schedd"})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	schedds, err := r.execPod(ctx, manager, "manager-node", []string{"condor_status", "-schedd", "-af", "Name"})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if strings.TrimSpace(schedds) != "" {
+		r.Log.Info("⏸️ Waiting for the schedds to checkpoint the queue", "Name", cluster.Name)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	// The next reconcile suspends the JobSet
+	err = r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionTrue, "Paused", "The pool is drained and the queue is on the spool")
+	return ctrl.Result{Requeue: true}, err
+}
+
+// resumePool tracks the pool coming back up. With an ordered startup, submit
+// and execute nodes wait for the collector, and execute nodes for the schedd
+func (r *HTCondorReconciler) resumePool(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	condition *metav1.Condition,
+) error {
+
+	// Resuming before the pool was paused turns the daemons back on
+	if condition.Reason == "Draining" || condition.Reason == "Checkpointing" {
+		manager, err := r.getRunningPod(ctx, cluster, "manager")
+		if err != nil {
+			return err
+		}
+		_, err = r.execPod(ctx, manager, "manager-node", []string{"condor_on", "-all"})
+		if err != nil {
+			return err
+		}
+		return r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "Resumed", "The pool was resumed before it was paused")
+	}
+
+	_, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "ResumingManager", "Waiting for the central manager")
+	}
+	_, err = r.getRunningPod(ctx, cluster, "submit")
+	if err != nil {
+		return r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "ResumingSchedd", "Waiting for the schedd to restore the queue")
+	}
+	if !meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionReady) {
+		return r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "ResumingExecute", "Waiting for execute nodes")
+	}
+	return r.setTransition(ctx, cluster, api.ConditionPaused, metav1.ConditionFalse, "Resumed", "The pool is running")
+}
@@ -11,6 +11,17 @@ SPDX-License-Identifier: Apache-2.0
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 )
 
@@ -22,3 +33,165 @@ func (r *HTCondorReconciler) getPodLabels(cluster *api.HTCondor) map[string]stri
 	podLabels["app.kubernetes.io/name"] = cluster.Name
 	return podLabels
 }
+
+// getRunningPod gets a running pod for a role (e.g., the manager) in the cluster
+func (r *HTCondorReconciler) getRunningPod(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	role string,
+) (*corev1.Pod, error) {
+
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels(getRoleSelector(cluster, role)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("there is no running %s pod for %s", role, cluster.Name)
+}
+
+// execPod runs a command in a pod container, returning stdout
+func (r *HTCondorReconciler) execPod(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container string,
+	command []string,
+) (string, error) {
+
+	req := r.RESTClient.Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(r.RESTConfig, "POST", req.URL())
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return stdout.String(), fmt.Errorf("%s: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// updateReady sets the Ready condition, with an event when it changes
+// The pool is ready when the manager, submit, and execute pods are running
+func (r *HTCondorReconciler) updateReady(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (bool, error) {
+
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{"cluster-name": cluster.Name},
+	)
+	if err != nil {
+		return false, err
+	}
+	running := int32(0)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			running++
+		}
+	}
+
+	// One or more managers and submit nodes, and size execute nodes
+	expected := cluster.Spec.Manager.Replicas + cluster.Spec.Submit.Replicas + cluster.Spec.Size
+	ready := running >= expected
+	condition := metav1.Condition{
+		Type:    api.ConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  "PodsPending",
+		Message: fmt.Sprintf("%d of %d pods are running", running, expected),
+	}
+
+	// A suspended pool has no pods on purpose, and isn't pending
+	if meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended) {
+		condition.Reason = "Suspended"
+		condition.Message = "The pool is suspended"
+		return false, r.setCondition(ctx, cluster, condition)
+	}
+
+	if ready {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "PodsRunning"
+	}
+
+	// Only update status (and record an event) when the pool changes
+	existing := meta.FindStatusCondition(cluster.Status.Conditions, api.ConditionReady)
+	if existing != nil && existing.Status == condition.Status && existing.Reason == condition.Reason {
+		return ready, nil
+	}
+	if ready {
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "PoolReady", "All %d pods are running", expected)
+	} else if existing != nil && existing.Status == metav1.ConditionTrue {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "PoolNotReady", condition.Message)
+	}
+	meta.SetStatusCondition(&cluster.Status.Conditions, condition)
+	return ready, r.Status().Update(ctx, cluster)
+}
+
+// setCondition sets a status condition, only updating status when it changes
+func (r *HTCondorReconciler) setCondition(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	condition metav1.Condition,
+) error {
+
+	existing := meta.FindStatusCondition(cluster.Status.Conditions, condition.Type)
+	if existing != nil &&
+		existing.Status == condition.Status &&
+		existing.Reason == condition.Reason &&
+		existing.Message == condition.Message {
+		return nil
+	}
+	meta.SetStatusCondition(&cluster.Status.Conditions, condition)
+	return r.Status().Update(ctx, cluster)
+}
+
+// setTransition sets a condition that tracks steps (e.g., pausing or starting),
+// with an event for each step
+func (r *HTCondorReconciler) setTransition(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	conditionType string,
+	status metav1.ConditionStatus,
+	reason string,
+	message string,
+) error {
+
+	existing := meta.FindStatusCondition(cluster.Status.Conditions, conditionType)
+	if existing == nil || existing.Reason != reason {
+		r.Log.Info("🔀 HTCondor transition", "Name", cluster.Name, "Condition", conditionType, "Reason", reason)
+		r.Recorder.Event(cluster, corev1.EventTypeNormal, "Pool"+reason, message)
+	}
+	return r.setCondition(ctx, cluster, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
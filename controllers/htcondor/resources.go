@@ -12,6 +12,7 @@ package controllers
 
 import (
 	"fmt"
+	"sort"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 
@@ -21,20 +22,30 @@ import (
 )
 
 // getResourceGroup can return a ResourceList for either requests or limits
+// The field is the path in the spec, to tell the user what to fix
 func (r *HTCondorReconciler) getResourceGroup(
 	items api.Resource,
+	field string,
 ) (corev1.ResourceList, error) {
 
 	r.Log.Info("🍅️ Resource", "items", items)
 	list := corev1.ResourceList{}
-	for key, unknownValue := range items {
+
+	// Sorted, so the same spec always reports the same error
+	keys := []string{}
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		unknownValue := items[key]
 		if unknownValue.Type == intstr.Int {
 
 			value := unknownValue.IntVal
 			r.Log.Info("🍅️ ResourceKey", "Key", key, "Value", value)
 			limit, err := resource.ParseQuantity(fmt.Sprintf("%d", value))
 			if err != nil {
-				return list, err
+				return list, fmt.Errorf("%s.%s: %d is not a valid quantity: %s", field, key, value, err)
 			}
 
 			if key == "memory" {
@@ -48,12 +59,17 @@ func (r *HTCondorReconciler) getResourceGroup(
 
 			value := unknownValue.StrVal
 			r.Log.Info("🍅️ ResourceKey", "Key", key, "Value", value)
+			limit, err := resource.ParseQuantity(value)
+			if err != nil {
+				return list, fmt.Errorf("%s.%s: %q is not a valid quantity: %s", field, key, value, err)
+			}
+
 			if key == "memory" {
-				list[corev1.ResourceMemory] = resource.MustParse(value)
+				list[corev1.ResourceMemory] = limit
 			} else if key == "cpu" {
-				list[corev1.ResourceCPU] = resource.MustParse(value)
+				list[corev1.ResourceCPU] = limit
 			} else {
-				list[corev1.ResourceName(key)] = resource.MustParse(value)
+				list[corev1.ResourceName(key)] = limit
 			}
 		}
 	}
@@ -61,16 +77,17 @@ func (r *HTCondorReconciler) getResourceGroup(
 }
 
 // getContainerResources determines if any resources are requested via the spec
-// This is for one node, which currently just has one container
+// This is for one container, either the node or an init or sidecar container
 func (r *HTCondorReconciler) getContainerResources(
-	node *api.Node,
+	spec *api.Resources,
+	field string,
 ) (corev1.ResourceRequirements, error) {
 
 	// memory int, setCPURequest, setCPULimit, setGPULimit int64
 	resources := corev1.ResourceRequirements{}
 
 	// Limits
-	limits, err := r.getResourceGroup(node.Resources.Limits)
+	limits, err := r.getResourceGroup(spec.Limits, field+".limits")
 	if err != nil {
 		r.Log.Error(err, "🍅️ Resources for Node.Limits")
 		return resources, err
@@ -78,7 +95,7 @@ func (r *HTCondorReconciler) getContainerResources(
 	resources.Limits = limits
 
 	// Requests
-	requests, err := r.getResourceGroup(node.Resources.Requests)
+	requests, err := r.getResourceGroup(spec.Requests, field+".requests")
 	if err != nil {
 		r.Log.Error(err, "🍅️ Resources for Node.Requests")
 		return resources, err
@@ -87,17 +104,90 @@ func (r *HTCondorReconciler) getContainerResources(
 	return resources, nil
 }
 
-// getPodResources determines if any resources are requested via the spec
+// getNodeResources determines the container resources for a node role
+// The pod level spec.resources are requests for every node, unless the
+// node sets a request or limit for the same resource itself
 func (r *HTCondorReconciler) getNodeResources(
 	cluster *api.HTCondor,
 	node api.Node,
-) (corev1.ResourceList, error) {
+	role string,
+) (corev1.ResourceRequirements, error) {
 
-	// memory int, setCPURequest, setCPULimit, setGPULimit int64
-	resources, err := r.getResourceGroup(cluster.Spec.Resources)
+	resources, err := r.getContainerResources(&node.Resources, fmt.Sprintf("spec.%s.resources", role))
 	if err != nil {
-		r.Log.Error(err, "🍅️ Resources for Node.Resources")
 		return resources, err
 	}
+	defaults, err := r.getResourceGroup(cluster.Spec.Resources, "spec.resources")
+	if err != nil {
+		r.Log.Error(err, "🍅️ Resources for Spec.Resources")
+		return resources, err
+	}
+	names := []string{}
+	for name := range defaults {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		name := corev1.ResourceName(key)
+		quantity := defaults[name]
+		_, hasRequest := resources.Requests[name]
+		_, hasLimit := resources.Limits[name]
+		if !hasRequest && !hasLimit {
+			resources.Requests[name] = quantity
+		}
+	}
 	return resources, nil
 }
+
+// validateResources parses every quantity in the spec up front, so a typo
+// is reported (with the field) instead of failing part way through
+func (r *HTCondorReconciler) validateResources(cluster *api.HTCondor) error {
+
+	_, err := r.getResourceGroup(cluster.Spec.Resources, "spec.resources")
+	if err != nil {
+		return err
+	}
+	nodes := map[string]api.Node{
+		"manager": cluster.Spec.Manager,
+		"submit":  cluster.Spec.Submit,
+		"execute": cluster.Spec.Execute,
+	}
+	for _, role := range []string{"manager", "submit", "execute"} {
+		node := nodes[role]
+		_, err = r.getContainerResources(&node.Resources, fmt.Sprintf("spec.%s.resources", role))
+		if err != nil {
+			return err
+		}
+		for _, extra := range node.InitContainers {
+			_, err = r.getContainerResources(&extra.Resources, fmt.Sprintf("spec.%s.initContainers[%s].resources", role, extra.Name))
+			if err != nil {
+				return err
+			}
+		}
+		for _, extra := range node.Sidecars {
+			_, err = r.getContainerResources(&extra.Resources, fmt.Sprintf("spec.%s.sidecars[%s].resources", role, extra.Name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Volume claims are only created when they have a size
+	storages := map[string]api.Storage{
+		"spec.spool":        cluster.Spec.Spool,
+		"spec.managerState": cluster.Spec.ManagerState,
+	}
+	for _, field := range []string{"spec.spool", "spec.managerState"} {
+		storage := storages[field]
+		if storage.Size == "" {
+			continue
+		}
+		_, err = getStorageSize(storage, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Extended resources on execute nodes are HTCondor machine resources
+	return validateMachineResources(cluster.Spec.Execute.Resources.Limits)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// updateSchedds updates status with each schedd and its queue totals
+func (r *HTCondorReconciler) updateSchedds(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) error {
+
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return err
+	}
+	out, err := r.execPod(
+		ctx, manager, "manager-node",
+		[]string{"condor_status", "-schedd", "-af", "Name", "TotalIdleJobs", "TotalRunningJobs", "TotalHeldJobs"},
+	)
+	if err != nil {
+		return err
+	}
+
+	var schedds []api.ScheddStatus
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		schedds = append(schedds, api.ScheddStatus{
+			Name:    fields[0],
+			Idle:    parseCount(fields[1]),
+			Running: parseCount(fields[2]),
+			Held:    parseCount(fields[3]),
+		})
+	}
+	sort.Slice(schedds, func(i, j int) bool {
+		return schedds[i].Name < schedds[j].Name
+	})
+	if reflect.DeepEqual(schedds, cluster.Status.Schedds) {
+		return nil
+	}
+	cluster.Status.Schedds = schedds
+	return r.Status().Update(ctx, cluster)
+}
+
+// parseCount parses a job total, which is undefined before the schedd reports it
+func parseCount(value string) int32 {
+	count, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(count)
+}
@@ -12,46 +12,131 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
-
-	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
+	jobset "sigs.k8s.io/jobset/api/v1alpha1"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 )
 
-// exposeService will expose services for job networking (headless)
-func (r *HTCondorReconciler) exposeServices(
+const (
+	// The manager service is a stable address for the collector
+	managerServiceSuffix  = "-manager"
+	scheddServiceSuffix   = "-schedd"
+	externalServiceSuffix = "-external"
+	collectorPort         = 9618
+)
+
+// getRoleSelector selects the pods for one role (replicated job) in the cluster
+func getRoleSelector(cluster *api.HTCondor, role string) map[string]string {
+
+	// JobSet labels each pod with the name of its replicated job
+	return map[string]string{
+		"cluster-name":              cluster.Name,
+		jobset.ReplicatedJobNameKey: role,
+	}
+}
+
+// exposeManagerService creates a ClusterIP service for the central manager
+func (r *HTCondorReconciler) exposeManagerService(
 	ctx context.Context,
 	cluster *api.HTCondor,
-	selector map[string]string,
 ) (ctrl.Result, error) {
 
-	// This service is for the restful API
-	existing := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{Name: cluster.Spec.ServiceName, Namespace: cluster.Namespace}, existing)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			_, err = r.createHeadlessService(ctx, cluster, selector)
+	// The collector port is always the same, even if the target is a node port
+	port := newServicePort(collectorPort, cluster.Spec.SharedPort("manager"), 0)
+	return r.exposeService(
+		ctx,
+		cluster,
+		cluster.Name+managerServiceSuffix,
+		getRoleSelector(cluster, "manager"),
+		[]corev1.ServicePort{port},
+		corev1.ServiceTypeClusterIP,
+		nil,
+	)
+}
+
+// exposeScheddServices creates a ClusterIP service for each schedd
+func (r *HTCondorReconciler) exposeScheddServices(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
 
+	port := newServicePort(collectorPort, cluster.Spec.SharedPort("submit"), 0)
+	for i := int32(0); i < cluster.Spec.Submit.Replicas; i++ {
+
+		// Each schedd is its own replicated job
+		selector := getRoleSelector(cluster, getScheddJobName(i))
+		result, err := r.exposeService(
+			ctx,
+			cluster,
+			fmt.Sprintf("%s%s-%d", cluster.Name, scheddServiceSuffix, i),
+			selector,
+			[]corev1.ServicePort{port},
+			corev1.ServiceTypeClusterIP,
+			nil,
+		)
+		if err != nil {
+			return result, err
 		}
-		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, err
+	return ctrl.Result{}, nil
 }
 
-// createHeadlessService creates the service
-func (r *HTCondorReconciler) createHeadlessService(
+// exposeExternalServices exposes the manager and submit nodes outside the cluster
+// The shared port daemon means each only needs one port
+func (r *HTCondorReconciler) exposeExternalServices(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) (ctrl.Result, error) {
+
+	nodes := map[string]api.ExposeNode{
+		"manager": cluster.Spec.Expose.Manager,
+		"submit":  cluster.Spec.Expose.Submit,
+	}
+	for _, role := range []string{"manager", "submit"} {
+		sharedPort := cluster.Spec.SharedPort(role)
+		port := newServicePort(sharedPort, sharedPort, nodes[role].NodePort)
+		result, err := r.exposeService(
+			ctx,
+			cluster,
+			cluster.Name+"-"+role+externalServiceSuffix,
+			getRoleSelector(cluster, role),
+			[]corev1.ServicePort{port},
+			cluster.Spec.Expose.Type,
+			cluster.Spec.Expose.Annotations,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// newServicePort creates a TCP service port, with an optional node port
+func newServicePort(port, targetPort, nodePort int32) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:     fmt.Sprintf("condor-%d", port),
+		Protocol: "TCP",
+
+		// This is a very weird parsing... OK
+		TargetPort: intstr.FromInt(int(targetPort)),
+		Port:       port,
+		NodePort:   nodePort,
+	}
+}
+
+// exposeService will expose services for job networking (headless)
+func (r *HTCondorReconciler) exposeServices(
 	ctx context.Context,
 	cluster *api.HTCondor,
 	selector map[string]string,
-) (*corev1.Service, error) {
+) (ctrl.Result, error) {
 
-	r.Log.Info("Creating headless service with: ", cluster.Spec.ServiceName, cluster.Namespace)
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{Name: cluster.Spec.ServiceName, Namespace: cluster.Namespace},
 		Spec: corev1.ServiceSpec{
@@ -59,56 +144,31 @@ func (r *HTCondorReconciler) createHeadlessService(
 			Selector:  selector,
 		},
 	}
-	ctrl.SetControllerReference(cluster, service, r.Scheme)
-	err := r.Client.Create(ctx, service)
-	if err != nil {
-		r.Log.Error(err, "🔴 Create service", "Service", service.Name)
-	}
-	return service, err
+	return ctrl.Result{}, r.apply(ctx, cluster, service)
 }
 
-// exposeService creates a port-specific service
+// exposeService applies a port-specific service
 func (r *HTCondorReconciler) exposeService(
 	ctx context.Context,
 	cluster *api.HTCondor,
 	serviceName string,
 	selector map[string]string,
-	ports []int32,
+	ports []corev1.ServicePort,
+	serviceType corev1.ServiceType,
+	annotations map[string]string,
 ) (ctrl.Result, error) {
 
-	// This service is for the restful API
-	existing := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{Name: serviceName, Namespace: cluster.Namespace}, existing)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			r.Log.Info("Creating service with: ", serviceName, cluster.Namespace)
-
-			// Assemble ports
-			servicePorts := []corev1.ServicePort{}
-			for _, port := range ports {
-				newPort := corev1.ServicePort{
-					Protocol: "TCP",
-
-					// This is a very weird parsing... OK
-					TargetPort: intstr.FromInt(int(port)),
-					Port:       port,
-				}
-				servicePorts = append(servicePorts, newPort)
-			}
-			service := &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{Name: serviceName, Namespace: cluster.Namespace},
-				Spec: corev1.ServiceSpec{
-					Selector: selector,
-					Ports:    servicePorts,
-				},
-			}
-			ctrl.SetControllerReference(cluster, service, r.Scheme)
-			err := r.Client.Create(ctx, service)
-			if err != nil {
-				r.Log.Error(err, "🔴 Create service", "Service", service.Name)
-			}
-		}
-		return ctrl.Result{}, err
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        serviceName,
+			Namespace:   cluster.Namespace,
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     serviceType,
+			Selector: selector,
+			Ports:    ports,
+		},
 	}
-	return ctrl.Result{}, err
+	return ctrl.Result{}, r.apply(ctx, cluster, service)
 }
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+// updateStarted sets the Started condition from the collector. For an ordered
+// startup the submit and execute nodes are gated in their start scripts, so
+// their pods are running before they join, and the reason shows which role
+// the pool is waiting on
+func (r *HTCondorReconciler) updateStarted(
+	ctx context.Context,
+	cluster *api.HTCondor,
+) error {
+
+	// A suspended pool starts again when it is resumed
+	if meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionSuspended) {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "Suspended", "The pool is suspended")
+	}
+
+	// Pods failing after startup are reported by the Ready condition
+	if meta.IsStatusConditionTrue(cluster.Status.Conditions, api.ConditionStarted) {
+		return nil
+	}
+
+	// The collector has to answer before we can ask it about the other roles
+	manager, err := r.getRunningPod(ctx, cluster, "manager")
+	if err != nil {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "WaitingForManager", "Waiting for the central manager")
+	}
+	schedds, err := r.execPod(ctx, manager, "manager-node", []string{"condor_status", "-schedd", "-af", "Name"})
+	if err != nil {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "WaitingForManager", "Waiting for the collector")
+	}
+	parallel := cluster.Spec.StartupPolicy == "parallel"
+	if !parallel && strings.TrimSpace(schedds) == "" {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "WaitingForSchedd", "Waiting for the schedd to join the pool")
+	}
+
+	// Execute nodes in the annex don't count toward the size of the pool
+	startds, err := r.execPod(ctx, manager, "manager-node", []string{
+		"condor_status", "-startd", "-constraint", annexAttribute + " =!= True", "-af", "Machine",
+	})
+	if err != nil {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "WaitingForManager", "Waiting for the collector")
+	}
+	joined := countMachines(startds)
+	if int32(joined) >= cluster.Spec.Size && strings.TrimSpace(schedds) != "" {
+		message := fmt.Sprintf("All roles have started (%s)", cluster.Spec.StartupPolicy)
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionTrue, "Started", message)
+	}
+	message := fmt.Sprintf("%d of %d execute nodes have joined the pool", joined, cluster.Spec.Size)
+	if parallel {
+		return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "StartingInParallel", message)
+	}
+	return r.setTransition(ctx, cluster, api.ConditionStarted, metav1.ConditionFalse, "WaitingForExecute", message)
+}
+
+// countMachines counts the machines in condor_status output
+// Partitionable slots mean the same machine can show up more than once
+func countMachines(out string) int {
+	machines := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		machine := strings.TrimSpace(line)
+		if machine != "" {
+			machines[machine] = true
+		}
+	}
+	return len(machines)
+}
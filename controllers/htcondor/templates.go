@@ -13,9 +13,14 @@ package controllers
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"text/template"
 
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	_ "embed"
 )
@@ -36,10 +41,142 @@ var startComponents string
 type NodeTemplate struct {
 	Node        api.Node
 	Spec        api.HTCondorSpec
+	Role        string
 	ClusterName string
 	Namespace   string
 }
 
+// ExposeHost is the external host advertised by the node, if any
+func (nt NodeTemplate) ExposeHost() string {
+	switch nt.Role {
+	case "manager":
+		return nt.Spec.Expose.Manager.Host
+	case "submit":
+		return nt.Spec.Expose.Submit.Host
+	}
+	return ""
+}
+
+// ManagerHosts are the hostnames of each (highly available) manager pod
+func (nt NodeTemplate) ManagerHosts() []string {
+	hosts := []string{}
+	for i := int32(0); i < nt.Spec.Manager.Replicas; i++ {
+		hosts = append(hosts, fmt.Sprintf(
+			"%s-manager-0-%d.%s.%s.svc.%s",
+			nt.ClusterName, i, nt.Spec.ServiceName, nt.Namespace, nt.Spec.ClusterDomain,
+		))
+	}
+	return hosts
+}
+
+// CollectorHost is the COLLECTOR_HOST for an exposed pool. Highly available
+// managers each run a collector, so nodes advertise to all of them
+func (nt NodeTemplate) CollectorHost() string {
+	if !nt.Spec.HighAvailability() {
+		return fmt.Sprintf("%s%s.%s.svc.%s:%d", nt.ClusterName, managerServiceSuffix, nt.Namespace, nt.Spec.ClusterDomain, collectorPort)
+	}
+	collectors := []string{}
+	for _, host := range nt.ManagerHosts() {
+		collectors = append(collectors, fmt.Sprintf("%s:%d", host, nt.Spec.SharedPort("manager")))
+	}
+	return strings.Join(collectors, ", ")
+}
+
+// MachineResource is a custom HTCondor machine resource for an execute node
+type MachineResource struct {
+
+	// Name in HTCondor, e.g., jobs use request_<name>
+	Name string
+
+	// Resource name in Kubernetes, e.g., example.com/fpga
+	Resource string
+	Count    int64
+}
+
+// MachineResources maps extended resources in the execute node limits
+// to HTCondor machine resources, so the counts match what Kubernetes allocated
+func (nt NodeTemplate) MachineResources() []MachineResource {
+	if nt.Role != "execute" {
+		return nil
+	}
+	return getMachineResources(nt.Node.Resources.Limits)
+}
+
+// Anything that isn't allowed in a config knob name
+var invalidKnobCharacters = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// getMachineResources finds extended (device) resources in a set of limits
+// Native resources (cpu, memory, storage, hugepages) are not devices
+func getMachineResources(limits api.Resource) []MachineResource {
+	resources := []MachineResource{}
+	for key, value := range limits {
+		if key == "cpu" || key == "memory" || key == "ephemeral-storage" || strings.HasPrefix(key, "hugepages-") {
+			continue
+		}
+
+		count := int64(value.IntVal)
+		if value.Type == intstr.String {
+			quantity, err := resource.ParseQuantity(value.StrVal)
+			if err != nil {
+				continue
+			}
+			count = quantity.Value()
+		}
+
+		// example.com/fpga is the fpga resource
+		name := key[strings.LastIndex(key, "/")+1:]
+		resources = append(resources, MachineResource{
+			Name:     invalidKnobCharacters.ReplaceAllString(name, "_"),
+			Resource: key,
+			Count:    count,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Resource < resources[j].Resource
+	})
+	return resources
+}
+
+// validateMachineResources checks extended resources map to distinct machine
+// resources, e.g., a.com/fpga and b.com/fpga would both be fpga
+func validateMachineResources(limits api.Resource) error {
+	seen := map[string]string{}
+	for _, resource := range getMachineResources(limits) {
+		if other, ok := seen[resource.Name]; ok {
+			return fmt.Errorf("spec.execute.resources.limits: %q and %q are both machine resource %s", other, resource.Resource, resource.Name)
+		}
+		seen[resource.Name] = resource.Resource
+	}
+	return nil
+}
+
+// HookTemplate populates a lifecycle hook for a node
+type HookTemplate struct {
+	Name      string
+	Command   string
+	OnFailure string
+}
+
+// Hook looks up a lifecycle hook for the node by name
+func (nt NodeTemplate) Hook(name string) HookTemplate {
+	hook := api.Hook{}
+	switch name {
+	case "preStart":
+		hook = nt.Node.Commands.PreStart
+	case "postReady":
+		hook = nt.Node.Commands.PostReady
+	case "preStop":
+		hook = nt.Node.Commands.PreStop
+	case "onExit":
+		hook = nt.Node.Commands.OnExit
+	}
+	return HookTemplate{
+		Name:      name,
+		Command:   hook.Command,
+		OnFailure: hook.OnFailure,
+	}
+}
+
 // combineTemplates into one "start"
 func combineTemplates(listing ...string) (t *template.Template, err error) {
 	t = template.New("start")
@@ -54,10 +191,11 @@ func combineTemplates(listing ...string) (t *template.Template, err error) {
 }
 
 // generateWorkerScript generates the main script to start everything up!
-func generateScript(cluster *api.HTCondor, node api.Node, startTemplate string) (string, error) {
+func generateScript(cluster *api.HTCondor, node api.Node, role string, startTemplate string) (string, error) {
 	nt := NodeTemplate{
 		Node:        node,
 		Spec:        cluster.Spec,
+		Role:        role,
 		ClusterName: cluster.Name,
 		Namespace:   cluster.Namespace,
 	}
@@ -3,12 +3,8 @@
 # Shared components for the broker and worker template
 {{define "init"}}
 
-# Give networking a few seconds...
-echo "Sleeping for networking..."
-sleep 3
-
 # Initialization commands
-{{ .Node.Commands.Init}} > /dev/null 2>&1
+{{ .Node.Commands.Init}}
 
 # The working directory should be set by the CRD or the container
 workdir=${PWD}
@@ -33,18 +29,328 @@ condor_store_cred -p {{.Spec.Config.Password}} -f /root/secrets/pool_password
 
 # TODO this should be actual cpus, not nodes
 export NUM_CPUS={{.Spec.Size}}
+{{ if eq .Role "execute" }}{{template "cgroups" .}}{{ end }}{{ if .Spec.Expose.Type }}{{template "expose" .}}{{ end }}
+{{ if and (eq .Role "manager") .Spec.HighAvailability }}{{template "high-availability" .}}{{ end }}
+{{ if and (eq .Role "manager") .Spec.Accounting.Groups }}{{template "accounting" .}}{{ end }}
+{{ if and (eq .Role "execute") .Spec.Policy.Configured }}{{template "policy" .}}{{ end }}
+{{ if and (eq .Role "execute") .Node.ContainerUniverse }}{{template "container-universe" .}}{{ end }}
+{{ if and (eq .Role "manager") (eq .Spec.Policy.Preset "neverPreempt") }}
+# Jobs are never preempted, so the negotiator doesn't look for claims to preempt
+echo "NEGOTIATOR_CONSIDER_PREEMPTION = False" >> /etc/condor/condor_config.local
+{{ end }}
+{{ range .MachineResources }}
+# Extended resource {{ .Resource }} is a machine resource, so jobs can request_{{ .Name }}
+echo "MACHINE_RESOURCE_{{ .Name }} = {{ .Count }}" >> /etc/condor/condor_config.local
+echo '{{ .Name }}_KubernetesResource = "{{ .Resource }}"' >> /etc/condor/condor_config.local
+echo 'STARTD_ATTRS = $(STARTD_ATTRS) {{ .Name }}_KubernetesResource' >> /etc/condor/condor_config.local
+{{ end }}
+
+# Flocking peers are rendered by the operator, and updated as they change
+# This is always included, so peers can be added to a running pool
+echo "include ifexist : /etc/condor/flocking/flocking.conf" >> /etc/condor/condor_config.local
+{{end}}
+
+{{define "high-availability"}}
+# Each manager runs a collector, and HAD elects the one running the negotiator
+# https://htcondor.readthedocs.io/en/latest/admin-manual/high-availability.html
+echo 'CONDOR_HOST = {{ range $i, $host := .ManagerHosts }}{{ if $i }}, {{ end }}{{ $host }}{{ end }}' >> /etc/condor/condor_config.local
+echo 'HAD_PORT = 51450' >> /etc/condor/condor_config.local
+echo 'REPLICATION_PORT = 41450' >> /etc/condor/condor_config.local
+echo 'HAD_LIST = {{ range $i, $host := .ManagerHosts }}{{ if $i }}, {{ end }}{{ $host }}:$(HAD_PORT){{ end }}' >> /etc/condor/condor_config.local
+echo 'REPLICATION_LIST = {{ range $i, $host := .ManagerHosts }}{{ if $i }}, {{ end }}{{ $host }}:$(REPLICATION_PORT){{ end }}' >> /etc/condor/condor_config.local
+echo 'HAD_ARGS = -p $(HAD_PORT)' >> /etc/condor/condor_config.local
+echo 'REPLICATION_ARGS = -p $(REPLICATION_PORT)' >> /etc/condor/condor_config.local
+echo 'HAD_USE_PRIMARY = False' >> /etc/condor/condor_config.local
+echo 'HAD_USE_REPLICATION = True' >> /etc/condor/condor_config.local
+echo 'HAD_CONNECTION_TIMEOUT = 2' >> /etc/condor/condor_config.local
+echo 'MASTER_NEGOTIATOR_CONTROLLER = HAD' >> /etc/condor/condor_config.local
+echo 'MASTER_HAD_BACKOFF_CONSTANT = 360' >> /etc/condor/condor_config.local
+echo 'DAEMON_LIST = $(DAEMON_LIST), HAD, REPLICATION' >> /etc/condor/condor_config.local
+
+# The negotiator state is replicated, and kept in a spool for this host
+mkdir -p /var/lib/condor/ha/$(hostname)
+chown condor:condor /var/lib/condor/ha/$(hostname)
+echo 'SPOOL = /var/lib/condor/ha/$(HOSTNAME)' >> /etc/condor/condor_config.local
+echo 'STATE_FILE = $(SPOOL)/Accountantnew.log' >> /etc/condor/condor_config.local
+echo 'VALID_SPOOL_FILES = $(VALID_SPOOL_FILES), SpoolVersion, Accountant.log, Accountantnew.log' >> /etc/condor/condor_config.local
+{{end}}
+
+{{define "accounting"}}
+# Group quotas for the negotiator, jobs set their accounting_group
+echo "GROUP_NAMES = {{ range $i, $group := .Spec.Accounting.Groups }}{{ if $i }}, {{ end }}{{ $group.Name }}{{ end }}" >> /etc/condor/condor_config.local
+{{ range .Spec.Accounting.Groups }}{{ if .DynamicQuota }}
+echo "GROUP_QUOTA_DYNAMIC_{{ .Name }} = {{ .DynamicQuota }}" >> /etc/condor/condor_config.local{{ else }}
+echo "GROUP_QUOTA_{{ .Name }} = {{ .Quota }}" >> /etc/condor/condor_config.local{{ end }}
+echo "GROUP_ACCEPT_SURPLUS_{{ .Name }} = {{ if .AcceptSurplus }}True{{ else }}False{{ end }}" >> /etc/condor/condor_config.local{{ if .PriorityFactor }}
+echo "GROUP_PRIO_FACTOR_{{ .Name }} = {{ .PriorityFactor }}" >> /etc/condor/condor_config.local{{ end }}
+{{ end }}{{end}}
+
+{{define "policy"}}
+# Policy for when execute nodes start, suspend, and preempt jobs
+cat <<'HTCONDOR_POLICY' >> /etc/condor/condor_config.local
+{{ if eq .Spec.Policy.Preset "neverPreempt" }}# Jobs run until they are done
+START = True
+SUSPEND = False
+PREEMPT = False
+KILL = False
+WANT_SUSPEND = False
+MAXJOBRETIREMENTTIME = $(HOUR) * 24 * 365
+{{ else if eq .Spec.Policy.Preset "preemptAfter" }}# Jobs can be preempted after running for {{ .Spec.Policy.PreemptAfterHours }} hours
+START = True
+SUSPEND = False
+PREEMPT = False
+KILL = False
+WANT_SUSPEND = False
+MAXJOBRETIREMENTTIME = $(HOUR) * {{ .Spec.Policy.PreemptAfterHours }}
+{{ else if eq .Spec.Policy.Preset "desktop" }}# Jobs are suspended when the node is in use, like a desktop
+use POLICY : DESKTOP
+{{ end }}{{ with .Spec.Policy.Start }}START = {{ . }}
+{{ end }}{{ with .Spec.Policy.Suspend }}SUSPEND = {{ . }}
+{{ end }}{{ with .Spec.Policy.Preempt }}PREEMPT = {{ . }}
+{{ end }}{{ with .Spec.Policy.Kill }}KILL = {{ . }}
+{{ end }}{{ with .Spec.Policy.MaxJobRetirementTime }}MAXJOBRETIREMENTTIME = {{ . }}
+{{ end }}HTCONDOR_POLICY
+{{end}}
+
+{{define "container-universe"}}
+# Jobs can run in container images, with sandboxes on a scratch volume
+chown condor:condor /var/lib/condor/execute
+echo "EXECUTE = /var/lib/condor/execute" >> /etc/condor/condor_config.local
+{{ if eq .Node.ContainerUniverse "apptainer" }}
+# Apptainer runs unprivileged, in a user namespace without its own pid namespace
+echo "SINGULARITY = /usr/bin/apptainer" >> /etc/condor/condor_config.local
+echo "SINGULARITY_IS_SETUID = False" >> /etc/condor/condor_config.local
+echo "SINGULARITY_USE_PID_NAMESPACES = False" >> /etc/condor/condor_config.local
+echo "SINGULARITY_TARGET_DIR = /srv" >> /etc/condor/condor_config.local
+{{ else if eq .Node.ContainerUniverse "docker" }}
+# The docker daemon runs in a sidecar, so docker uses its socket, and the
+# client is copied from the docker image by an init container
+if [ ! -x /opt/htcondor-docker/bin/docker ]; then
+    echo "The docker client is missing from /opt/htcondor-docker/bin"
+    exit 1
+fi
+cat <<'HTCONDOR_DOCKER' > /usr/local/bin/condor-docker
+#!/bin/sh
+exec /opt/htcondor-docker/bin/docker -H unix:///var/run/dind/docker.sock "$@"
+HTCONDOR_DOCKER
+chmod +x /usr/local/bin/condor-docker
+echo "DOCKER = /usr/local/bin/condor-docker" >> /etc/condor/condor_config.local
+
+# The daemon puts its socket in the condor group, so HTCondor (but not jobs)
+# can use it, and it is stopped once this container is done for good
+id -g condor > /var/run/dind/condor-gid
+trap 'status=$?; {{ if ne .Node.RestartPolicy "Never" }}[ ${status} -ne 0 ] || {{ end }}touch /var/run/dind/done; exit ${status}' EXIT
+attempts=0
+until [ -S /var/run/dind/docker.sock ]; do
+    attempts=$((attempts+1))
+    if [ {{ .Spec.Readiness.Retries }} -gt 0 ] && [ ${attempts} -ge {{ .Spec.Readiness.Retries }} ]; then
+        echo "Gave up waiting for the docker daemon after ${attempts} attempts"
+        exit 1
+    fi
+    echo "Waiting for the docker daemon..."
+    sleep {{ .Spec.Readiness.Interval }}
+done
+{{ end }}{{end}}
+
+{{define "cgroups"}}
+# HTCondor would see the whole node, so size slots from the container cgroup
+if [ -f /sys/fs/cgroup/cgroup.controllers ]; then
+    memory_limit=$(cat /sys/fs/cgroup/memory.max 2>/dev/null)
+    cpu_quota=$(cut -d' ' -f1 /sys/fs/cgroup/cpu.max 2>/dev/null)
+    cpu_period=$(cut -d' ' -f2 /sys/fs/cgroup/cpu.max 2>/dev/null)
+else
+    memory_limit=$(cat /sys/fs/cgroup/memory/memory.limit_in_bytes 2>/dev/null)
+    cpu_quota=$(cat /sys/fs/cgroup/cpu/cpu.cfs_quota_us 2>/dev/null)
+    cpu_period=$(cat /sys/fs/cgroup/cpu/cpu.cfs_period_us 2>/dev/null)
+fi
+
+# No limit is "max" (v2) or a very large number (v1)
+node_memory=$(awk '/MemTotal/ {print $2}' /proc/meminfo)
+if [ -n "${memory_limit}" ] && [ "${memory_limit}" != "max" ] && [ "$((memory_limit / 1024))" -lt "${node_memory}" ]; then
+    echo "Container memory limit is $((memory_limit / 1048576)) MB"
+    echo "MEMORY = $((memory_limit / 1048576))" >> /etc/condor/condor_config.local
+fi
+if [ -n "${cpu_quota}" ] && [ "${cpu_quota}" != "max" ] && [ "${cpu_quota}" -gt 0 ] && [ -n "${cpu_period}" ]; then
+    # Partial cpus are rounded up, a limit of 1.5 is 2 slots sharing the quota
+    export NUM_CPUS=$(( (cpu_quota + cpu_period - 1) / cpu_period ))
+    echo "Container cpu limit is ${NUM_CPUS} cpus"
+    echo "NUM_CPUS = ${NUM_CPUS}" >> /etc/condor/condor_config.local
+fi
+
+# Jobs get their own cgroup under the container's, so they are held to
+# what they requested instead of the whole pod being OOM killed
+if [ -w /sys/fs/cgroup ]; then
+    echo "BASE_CGROUP = htcondor" >> /etc/condor/condor_config.local
+    echo "CGROUP_MEMORY_LIMIT_POLICY = hard" >> /etc/condor/condor_config.local
+else
+    echo "The cgroup filesystem is read only, so jobs are not limited by cgroups"
+    echo "CGROUP_MEMORY_LIMIT_POLICY = none" >> /etc/condor/condor_config.local
+fi
+{{end}}
+
+{{define "flocking-watch"}}
+# Reconfigure the daemons when the operator updates the flocking peers
+(
+flocking_sum=$(md5sum /etc/condor/flocking/flocking.conf 2>/dev/null)
+while true; do
+    sleep 30
+    current_sum=$(md5sum /etc/condor/flocking/flocking.conf 2>/dev/null)
+    if [ "${current_sum}" != "${flocking_sum}" ]; then
+        echo "Flocking peers changed, reconfiguring"
+        condor_reconfig
+        flocking_sum=${current_sum}
+    fi
+done
+) &
+{{end}}
+
+{{define "expose"}}
+# The pool is exposed outside the cluster, so each node uses one (shared) port
+echo "USE_SHARED_PORT = True" >> /etc/condor/condor_config.local
+echo "SHARED_PORT_PORT = {{ .Spec.SharedPort .Role }}" >> /etc/condor/condor_config.local
+echo "COLLECTOR_HOST = {{ .CollectorHost }}" >> /etc/condor/condor_config.local
+
+# Nodes in the cluster talk to each other on their private (pod) addresses
+echo "PRIVATE_NETWORK_NAME = {{ .ClusterName }}.{{ .Namespace }}" >> /etc/condor/condor_config.local
+{{ if eq .Role "execute" }}
+# Execute nodes are not exposed, so connections to them go through the collector
+echo 'CCB_ADDRESS = $(COLLECTOR_HOST)' >> /etc/condor/condor_config.local
+{{ else if .ExposeHost }}
+# Advertise the address clients outside the cluster can reach
+echo "TCP_FORWARDING_HOST = {{ .ExposeHost }}" >> /etc/condor/condor_config.local
+{{ end }}{{end}}
+
+{{define "hook"}}{{ if .Command }}
+# Lifecycle hook: {{ .Name }}
+echo "Running {{ .Name }} commands"
+(
+set -e
+{{ .Command }}
+) 2>&1
+hook_status=$?
+if [ ${hook_status} -ne 0 ]; then
+    echo "{{ .Name }} commands failed with exit code ${hook_status}"{{ if eq .OnFailure "fail" }}
+    exit ${hook_status}{{ end }}
+fi
+{{ end }}{{ end }}
+
+{{define "daemons"}}
+{{template "hook" (.Hook "preStart")}}
+
+# Run the daemons in the background so we can run hooks around them
+# https://github.com/htcondor/htcondor/blob/main/build/docker/services/base/start.sh
+bash -x /start.sh &
+daemons_pid=$!
+
+# Run the preStop hook when asked to terminate, then pass the signal on
+on_stop() {
+{{template "hook" (.Hook "preStop")}}
+    kill -TERM ${daemons_pid}
+}
+trap on_stop TERM INT
+{{template "flocking-watch" .}}
+{{end}}
+
+{{define "post-ready"}}{{ if .Node.Commands.PostReady.Command }}
+# The postReady hook runs in the background once this node joins the pool,
+# so it never keeps us from waiting on (and stopping) the daemons
+(
+attempts=0
+until condor_status -any -af Machine 2>/dev/null | grep -q "$(hostname)"; do
+    kill -0 ${daemons_pid} 2>/dev/null || exit 0
+    attempts=$((attempts+1))
+    if [ {{ .Spec.Readiness.Retries }} -gt 0 ] && [ ${attempts} -ge {{ .Spec.Readiness.Retries }} ]; then
+        echo "Gave up waiting for $(hostname) to join the pool after ${attempts} attempts"
+        exit 1
+    fi
+    echo "Waiting for $(hostname) to join the pool"
+    sleep {{ .Spec.Readiness.Interval }}
+done
+{{template "hook" (.Hook "postReady")}}
+){{ if eq .Node.Commands.PostReady.OnFailure "fail" }} || kill -TERM ${daemons_pid}{{ end }} &
+{{ end }}{{end}}
+
+{{define "wait"}}
+wait ${daemons_pid}
+daemons_status=$?
+
+# A trap interrupts wait, so wait again for the daemons to finish stopping
+if kill -0 ${daemons_pid} 2>/dev/null; then
+    wait ${daemons_pid}
+    daemons_status=$?
+fi
+echo "HTCondor daemons exited with status ${daemons_status}"
+{{template "hook" (.Hook "onExit")}}
 {{end}}
 
 {{define "exit"}}
 {{ if .Spec.Interactive }}sleep infinity{{ end }}
+exit ${daemons_status:-0}
 {{ end }}
 
+{{define "manager-host"}}{{ .ClusterName }}-manager.{{ .Namespace }}.svc.{{ .Spec.ClusterDomain }}{{end}}
+
 {{define "condor-host"}}
 
 export USE_POOL_PASSWORD=yes
-export CONDOR_HOST={{ .ClusterName }}-manager-0-0.{{ .Spec.ServiceName }}.{{ .Namespace }}.svc.cluster.local
+{{ if .Spec.HighAvailability }}export CONDOR_HOST="{{ range $i, $host := .ManagerHosts }}{{ if $i }}, {{ end }}{{ $host }}{{ end }}"
+{{ else }}export CONDOR_HOST={{template "manager-host" .}}
+{{ end }}
 # export CONDOR_SERVICE_HOST=${CONDOR_HOST}
 {{ end }}
 
-# Ohno, not DNS again!
+{{define "wait-dns"}}{{ if eq .Role "manager" }}
+# Wait for the manager hostnames other pods use (through the headless service)
+# to resolve. The trailing dot skips /etc/hosts, where a pod always finds its
+# own name, so this waits for DNS
+manager_hosts="{{ range $i, $host := .ManagerHosts }}{{ if $i }} {{ end }}{{ $host }}.{{ end }}"{{ else }}
+# Wait for the central manager hostname to resolve, instead of a blind sleep
+manager_hosts={{template "manager-host" .}}{{ end }}
+for manager_host in ${manager_hosts}; do
+    attempts=0
+    until getent hosts ${manager_host} > /dev/null 2>&1; do
+        attempts=$((attempts+1))
+        if [ {{ .Spec.Readiness.Retries }} -gt 0 ] && [ ${attempts} -ge {{ .Spec.Readiness.Retries }} ]; then
+            echo "Gave up waiting for ${manager_host} to resolve after ${attempts} attempts"
+            exit 1
+        fi
+        echo "Waiting for ${manager_host} to resolve..."
+        sleep {{ .Spec.Readiness.Interval }}
+    done
+    echo "${manager_host} resolves to $(getent hosts ${manager_host})"
+done
+{{end}}
+
+{{define "wait-collector"}}
+{{template "wait-dns" .}}
+# Then wait for the collector to accept connections
+attempts=0
+until timeout {{ .Spec.Readiness.Timeout }} bash -c "</dev/tcp/${manager_host}/9618" > /dev/null 2>&1; do
+    attempts=$((attempts+1))
+    if [ {{ .Spec.Readiness.Retries }} -gt 0 ] && [ ${attempts} -ge {{ .Spec.Readiness.Retries }} ]; then
+        echo "Gave up waiting for the collector at ${manager_host}:9618 after ${attempts} attempts"
+        exit 1
+    fi
+    echo "Waiting for the collector at ${manager_host}:9618..."
+    sleep {{ .Spec.Readiness.Interval }}
+done
+echo "The collector at ${manager_host}:9618 is accepting connections"
+{{end}}
+
+{{define "wait-schedd"}}
+# Execute nodes wait for the schedd, e.g., to restore the queue from the spool
+attempts=0
+until [ -n "$(condor_status -pool ${manager_host} -schedd -af Name 2>/dev/null)" ]; do
+    attempts=$((attempts+1))
+    if [ {{ .Spec.Readiness.Retries }} -gt 0 ] && [ ${attempts} -ge {{ .Spec.Readiness.Retries }} ]; then
+        echo "Gave up waiting for the schedd after ${attempts} attempts"
+        exit 1
+    fi
+    echo "Waiting for the schedd to join the pool..."
+    sleep {{ .Spec.Readiness.Interval }}
+done
+echo "The schedd has joined the pool"
+{{end}}
+
+# Ohno, not DNS again! The wait-dns step above is here because of this:
 # 06/18/23 22:49:02 WARNING: Saw slow DNS query, which may impact entire system: getaddrinfo(htcondor-sample-manager-0-0.htc-service.htcondor-operator.svc.cluster.local) took 3.918414 seconds.
\ No newline at end of file
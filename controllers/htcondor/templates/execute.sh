@@ -9,8 +9,14 @@ echo "Hello, I am an execute note with $(hostname)"
 
 # Environment variables specific to submit
 {{template "condor-host" . }}
+{{ if eq .Spec.StartupPolicy "parallel" }}{{template "wait-dns" . }}{{ else }}
+# Ordered startup waits for the collector, and then the schedd
+{{template "wait-collector" . }}
+{{template "wait-schedd" . }}{{ end }}
 
-# https://github.com/htcondor/htcondor/blob/main/build/docker/services/base/start.sh
-exec bash -x /start.sh
+# Start the daemons with lifecycle hooks around them
+{{template "daemons" .}}
+{{template "post-ready" .}}
+{{template "wait" .}}
 
 {{template "exit" .}}
\ No newline at end of file
@@ -7,11 +7,16 @@ echo "Hello, I am a server with $(hostname)"
 
 {{template "config" .}}
 
+# Other pods reach the collector by its hostname, so wait for it to be in DNS
+{{template "wait-dns" .}}
+
 export USE_POOL_PASSWORD=yes
 condor_store_cred -p password -f /htcondor_operator/pool_password
 
-# See https://github.com/htcondor/htcondor/blob/main/build/docker/services/base/start.sh
-exec bash -x /start.sh
+# Start the daemons with lifecycle hooks around them
+{{template "daemons" .}}
+{{template "post-ready" .}}
+{{template "wait" .}}
 
 # TODO how to run a job one off?
 {{template "exit" .}}
\ No newline at end of file
@@ -9,18 +9,24 @@ echo "Hello, I am a worker with $(hostname)"
 
 # Environment variables specific to submit
 {{template "condor-host" . }}
+{{ if eq .Spec.StartupPolicy "parallel" }}{{template "wait-dns" . }}{{ else }}
+# Ordered startup waits for the collector
+{{template "wait-collector" . }}{{ end }}
 
-# TODO what happens here?
-# https://github.com/htcondor/htcondor/blob/main/build/docker/services/base/start.sh
-exec bash -x /start.sh &
-while [ `condor_status -af activity|grep Idle|wc -l` -ne 2 ]
-  do
-    echo "Waiting for cluster to become ready";
-    sleep 2
-  done
-echo "HTCondor properly configured"
-
-# Keep the submit node running
-sleep infinity
+# Each schedd has a unique name, from its job in the JobSet
+echo "SCHEDD_NAME = {{ .ClusterName }}-schedd-${HTCONDOR_SCHEDD_INDEX}" >> /etc/condor/condor_config.local
+{{ if .Spec.Spool.Size }}
+# The spool is a persistent volume, so the queue survives the pool being paused
+# Each schedd has its own volume
+chown -R condor:condor /var/lib/condor/spool
+{{ end }}
+# Start the daemons with lifecycle hooks around them
+{{template "daemons" .}}
+
+# The postReady hook runs once the schedd has joined the pool
+{{template "post-ready" .}}
+
+# Keep the submit node running as long as the daemons are
+{{template "wait" .}}
 
 {{template "exit" .}}
\ No newline at end of file
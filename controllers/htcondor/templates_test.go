@@ -0,0 +1,155 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+func TestGetMachineResources(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits api.Resource
+		want   []MachineResource
+	}{
+		{
+			name: "native resources are not machine resources",
+			limits: api.Resource{
+				"cpu":                intstr.FromInt(4),
+				"memory":             intstr.FromString("4Gi"),
+				"ephemeral-storage":  intstr.FromString("10Gi"),
+				"hugepages-2Mi":      intstr.FromString("1Gi"),
+				"example.com/fpga":   intstr.FromInt(2),
+				"nvidia.com/gpu":     intstr.FromString("1"),
+				"example.com/my-nic": intstr.FromString("3"),
+			},
+			want: []MachineResource{
+				{Name: "fpga", Resource: "example.com/fpga", Count: 2},
+				{Name: "my_nic", Resource: "example.com/my-nic", Count: 3},
+				{Name: "gpu", Resource: "nvidia.com/gpu", Count: 1},
+			},
+		},
+		{
+			name:   "invalid quantities are skipped",
+			limits: api.Resource{"example.com/fpga": intstr.FromString("two")},
+			want:   []MachineResource{},
+		},
+		{
+			name:   "no limits",
+			limits: api.Resource{},
+			want:   []MachineResource{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := getMachineResources(test.limits)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateMachineResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  api.Resource
+		wantErr bool
+	}{
+		{
+			name:   "distinct names",
+			limits: api.Resource{"a.com/fpga": intstr.FromInt(1), "b.com/gpu": intstr.FromInt(1)},
+		},
+		{
+			name:    "same name from different vendors",
+			limits:  api.Resource{"a.com/fpga": intstr.FromInt(1), "b.com/fpga": intstr.FromInt(2)},
+			wantErr: true,
+		},
+		{
+			name:    "same name after sanitizing",
+			limits:  api.Resource{"a.com/my-nic": intstr.FromInt(1), "a.com/my_nic": intstr.FromInt(1)},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateMachineResources(test.limits)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateScriptMachineResources(t *testing.T) {
+	cluster := &api.HTCondor{}
+	cluster.Name = "htcondor-sample"
+	cluster.Namespace = "default"
+	cluster.Spec.Size = 2
+	cluster.Spec.Execute.Resources.Limits = api.Resource{"example.com/fpga": intstr.FromInt(2)}
+	err := cluster.Validate()
+	if err != nil {
+		t.Fatalf("Validate: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		role     string
+		template string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "execute nodes advertise machine resources",
+			role:     "execute",
+			template: startExecuteTemplate,
+			want: []string{
+				`echo "MACHINE_RESOURCE_fpga = 2" >> /etc/condor/condor_config.local`,
+				`echo 'fpga_KubernetesResource = "example.com/fpga"' >> /etc/condor/condor_config.local`,
+				`echo 'STARTD_ATTRS = $(STARTD_ATTRS) fpga_KubernetesResource' >> /etc/condor/condor_config.local`,
+			},
+		},
+		{
+			name:     "other roles do not",
+			role:     "manager",
+			template: startManagerTemplate,
+			notWant:  []string{"MACHINE_RESOURCE_"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := cluster.Spec.Manager
+			if test.role == "execute" {
+				node = cluster.Spec.Execute
+			}
+			script, err := generateScript(cluster, node, test.role, test.template)
+			if err != nil {
+				t.Fatalf("generateScript: %s", err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script is missing %q", want)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(script, notWant) {
+					t.Errorf("script should not contain %q", notWant)
+				}
+			}
+		})
+	}
+}
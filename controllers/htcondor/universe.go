@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+This is part of the Flux resource manager framework.
+For details, see https://github.com/flux-framework.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
+)
+
+const (
+	executeSuffix       = "-execute"
+	dockerSuffix        = "-docker"
+	dockerStorageSuffix = "-docker-storage"
+	dockerClientSuffix  = "-docker-client"
+
+	// Job sandboxes are on an emptyDir, instead of the container filesystem,
+	// and the docker daemon bind mounts them at the same path
+	executePath = "/var/lib/condor/execute"
+
+	// The docker daemon runs in a sidecar, and shares its socket
+	dockerContainerName = "docker"
+	dockerImage         = "docker:24-dind"
+	dockerSocketPath    = "/var/run/dind"
+
+	// The execute node writes the condor group id for the socket, and marks
+	// when it is done, so the daemon can stop and the pod can complete
+	dockerGroupFile = dockerSocketPath + "/condor-gid"
+	dockerDoneFile  = dockerSocketPath + "/done"
+
+	// The execute image has no docker client, so it is copied from the
+	// docker image by an init container
+	dockerClientContainerName = "docker-client"
+	dockerClientPath          = "/opt/htcondor-docker/bin"
+)
+
+// getSecurityContext is the least privilege the node container needs
+// Apptainer creates user namespaces, which the default seccomp profile blocks,
+// and docker runs in its own (privileged) sidecar, so neither is privileged
+func getSecurityContext(cluster *api.HTCondor, node api.Node, role string) *corev1.SecurityContext {
+	securityContext := &corev1.SecurityContext{
+		Privileged: &cluster.Spec.SecurityContext.Privileged,
+	}
+	if role == "execute" && node.ContainerUniverse == "apptainer" {
+		securityContext.SeccompProfile = &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeUnconfined,
+		}
+	}
+	return securityContext
+}
+
+// getUniverseAnnotations unconfine AppArmor for apptainer, which mounts
+// the job container filesystem
+func getUniverseAnnotations(node api.Node, role string) map[string]string {
+	if node.ContainerUniverse != "apptainer" {
+		return nil
+	}
+	key := fmt.Sprintf("container.apparmor.security.beta.kubernetes.io/%s-node", role)
+	return map[string]string{key: "unconfined"}
+}
+
+// getUniverseVolumes are the scratch volumes for the container universe
+func getUniverseVolumes(cluster *api.HTCondor, node api.Node) []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name:         cluster.Name + executeSuffix,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+	}
+	if node.ContainerUniverse == "docker" {
+		volumes = append(volumes, corev1.Volume{
+			Name:         cluster.Name + dockerSuffix,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+
+		// Images and layers can't be on the (overlay) container filesystem
+		volumes = append(volumes, corev1.Volume{
+			Name:         cluster.Name + dockerStorageSuffix,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name:         cluster.Name + dockerClientSuffix,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+	return volumes
+}
+
+// getUniverseVolumeMounts are the container universe mounts for the node
+func getUniverseVolumeMounts(cluster *api.HTCondor, node api.Node) []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      cluster.Name + executeSuffix,
+			MountPath: executePath,
+		},
+	}
+	if node.ContainerUniverse == "docker" {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      cluster.Name + dockerSuffix,
+			MountPath: dockerSocketPath,
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      cluster.Name + dockerClientSuffix,
+			MountPath: dockerClientPath,
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
+
+// getDockerClientContainer copies the (static) docker client from the
+// docker image, for the execute node to talk to the daemon
+func getDockerClientContainer(cluster *api.HTCondor) corev1.Container {
+	return corev1.Container{
+		Name:            dockerClientContainerName,
+		Image:           dockerImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"cp", "/usr/local/bin/docker", dockerClientPath + "/docker"},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: cluster.Name + dockerClientSuffix, MountPath: dockerClientPath},
+		},
+	}
+}
+
+// dockerdScript runs the docker daemon with its socket in the condor group,
+// which dockerd sets again each time it (re)starts. The daemon is stopped
+// when the execute node is done, since a sidecar would keep the pod running
+var dockerdScript = fmt.Sprintf(`rm -f %[2]s
+until [ -f %[1]s ]; do
+    sleep 1
+done
+dockerd --host=unix://%[3]s/docker.sock --group=$(cat %[1]s) &
+dockerd_pid=$!
+trap 'kill -TERM ${dockerd_pid}' TERM INT
+until [ -f %[2]s ]; do
+    kill -0 ${dockerd_pid} 2>/dev/null || exit 1
+    sleep 1
+done
+kill -TERM ${dockerd_pid}
+wait ${dockerd_pid}
+`, dockerGroupFile, dockerDoneFile, dockerSocketPath)
+
+// getDockerContainer runs the docker daemon for docker universe jobs
+// This is the only privileged container, the execute node uses its socket
+func getDockerContainer(cluster *api.HTCondor) corev1.Container {
+	privileged := true
+	return corev1.Container{
+		Name:            dockerContainerName,
+		Image:           dockerImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", dockerdScript},
+
+		// The socket is only shared in the pod, so TLS isn't needed
+		Env: []corev1.EnvVar{{Name: "DOCKER_TLS_CERTDIR", Value: ""}},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: cluster.Name + executeSuffix, MountPath: executePath},
+			{Name: cluster.Name + dockerSuffix, MountPath: dockerSocketPath},
+			{Name: cluster.Name + dockerStorageSuffix, MountPath: "/var/lib/docker"},
+		},
+		SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+	}
+}
@@ -11,12 +11,26 @@ SPDX-License-Identifier: Apache-2.0
 package controllers
 
 import (
+	"context"
+	"fmt"
+
 	api "github.com/converged-computing/htcondor-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	entrypointSuffix = "-entrypoint"
+	entrypointSuffix   = "-entrypoint"
+	spoolSuffix        = "-spool"
+	managerStateSuffix = "-manager-state"
+
+	// Where the HTCondor images keep the schedd queue
+	spoolPath = "/var/lib/condor/spool"
+
+	// Highly available managers each keep a spool (with the replicated
+	// negotiator state) in a directory named for the host
+	managerStatePath = "/var/lib/condor/ha"
 )
 
 // GetVolumeMounts returns read only volume for entrypoint scripts, etc.
@@ -27,6 +41,11 @@ func getVolumeMounts(cluster *api.HTCondor) []corev1.VolumeMount {
 			MountPath: "/htcondor_operator/",
 			ReadOnly:  true,
 		},
+		{
+			Name:      cluster.Name + flockingSuffix,
+			MountPath: "/etc/condor/flocking/",
+			ReadOnly:  true,
+		},
 	}
 	return mounts
 }
@@ -74,6 +93,116 @@ func getVolumes(cluster *api.HTCondor) []corev1.Volume {
 				},
 			},
 		},
+		{
+			Name: cluster.Name + flockingSuffix,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+
+					// /etc/condor/flocking/flocking.conf is updated as peers change
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: cluster.Name + flockingSuffix,
+					},
+				},
+			},
+		},
 	}
 	return volumes
 }
+
+// getSpoolName is the volume claim for a schedd spool. The first schedd
+// keeps the original name, so its queue is found when replicas change
+func getSpoolName(cluster *api.HTCondor, index int32) string {
+	if index == 0 {
+		return cluster.Name + spoolSuffix
+	}
+	return fmt.Sprintf("%s%s-%d", cluster.Name, spoolSuffix, index)
+}
+
+// getSpoolVolume is the persistent volume claim for a schedd spool
+func getSpoolVolume(cluster *api.HTCondor, index int32) corev1.Volume {
+	return corev1.Volume{
+		Name: getSpoolName(cluster, index),
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: getSpoolName(cluster, index),
+			},
+		},
+	}
+}
+
+// getSpoolVolumeMount mounts the spool where the schedd keeps the queue
+func getSpoolVolumeMount(cluster *api.HTCondor, index int32) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      getSpoolName(cluster, index),
+		MountPath: spoolPath,
+	}
+}
+
+// getManagerStateVolume is shared by highly available managers
+// The REPLICATION daemon keeps the state in sync, so it can be an emptyDir
+func getManagerStateVolume(cluster *api.HTCondor) corev1.Volume {
+	volume := corev1.Volume{
+		Name: cluster.Name + managerStateSuffix,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	if cluster.Spec.ManagerState.Size != "" {
+		volume.VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: cluster.Name + managerStateSuffix,
+			},
+		}
+	}
+	return volume
+}
+
+// getManagerStateVolumeMount mounts the state for highly available managers
+func getManagerStateVolumeMount(cluster *api.HTCondor) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      cluster.Name + managerStateSuffix,
+		MountPath: managerStatePath,
+	}
+}
+
+// getStorageSize parses the size of a volume claim
+func getStorageSize(storage api.Storage, field string) (resource.Quantity, error) {
+	size, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return size, fmt.Errorf("%s.size: %q is not a valid quantity: %s", field, storage.Size, err)
+	}
+	return size, nil
+}
+
+// ensureVolumeClaim applies a persistent volume claim for some storage
+// The claim is owned by the HTCondor, so it is kept while the pool is paused
+func (r *HTCondorReconciler) ensureVolumeClaim(
+	ctx context.Context,
+	cluster *api.HTCondor,
+	name string,
+	storage api.Storage,
+	accessMode corev1.PersistentVolumeAccessMode,
+	field string,
+) error {
+
+	size, err := getStorageSize(storage, field)
+	if err != nil {
+		return err
+	}
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cluster.Namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{accessMode},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+	if storage.StorageClassName != "" {
+		claim.Spec.StorageClassName = &storage.StorageClassName
+	}
+	return r.apply(ctx, cluster, claim)
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -58,11 +59,18 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var poolMetricsInterval time.Duration
+	var imageCatalog string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&poolMetricsInterval, "pool-metrics-interval", 30*time.Second,
+		"How often to query each HTCondor pool for metrics, 0 to disable.")
+	flag.StringVar(&imageCatalog, "image-catalog", "",
+		"Path to an image catalog (e.g., a mounted ConfigMap) mapping HTCondor versions and base OS to images. "+
+			"The built-in catalog is used if not set.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -107,6 +115,16 @@ func main() {
 		setupLog.Error(err, "unable to create REST client", "controller", restClient)
 	}
 
+	// An operator-level catalog replaces the built-in images
+	images := &controllers.DefaultImageCatalog
+	if imageCatalog != "" {
+		images, err = controllers.LoadImageCatalog(imageCatalog)
+		if err != nil {
+			setupLog.Error(err, "unable to load image catalog")
+			os.Exit(1)
+		}
+	}
+
 	// Create the new reconciler
 	if err = (&controllers.HTCondorReconciler{
 		Log:        ctrl.Log.WithName("hyperqueue-reconciler"),
@@ -114,6 +132,10 @@ func main() {
 		Scheme:     mgr.GetScheme(),
 		RESTConfig: mgr.GetConfig(),
 		RESTClient: restClient,
+		Recorder:   mgr.GetEventRecorderFor("htcondor-controller"),
+
+		MetricsInterval: poolMetricsInterval,
+		Images:          images,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Hyperqueue")
 		os.Exit(1)